@@ -2,6 +2,7 @@ package bundledb
 
 import (
     "reflect"
+    "sort"
     "unsafe"
 )
 
@@ -94,6 +95,34 @@ func searchBytes(a []Key, value Key) int {
     return -(lo + 1)
 }
 
+// The largest of the sorted `keys` that is <= `key`.
+func floorKey(keys []Key, key Key) (Key, bool) {
+    ix := sort.Search(len(keys), func(i int) bool { return keys[i] > key })
+    if ix == 0 {
+        return 0, false
+    }
+    return keys[ix - 1], true
+}
+
+// Index of the first key at or after `from` that is >= `value`. Steps forward in doubling strides before the binary
+// search, so seeking a little way ahead of the current position is cheap.
+func gallopKeys(a []Key, from int, value Key) int {
+    if from >= len(a) || a[from] >= value {
+        return from
+    }
+    lo, step := from, 1
+    hi := lo + step
+    for hi < len(a) && a[hi] < value {
+        lo = hi
+        step *= 2
+        hi = lo + step
+    }
+    if hi > len(a) {
+        hi = len(a)
+    }
+    return lo + 1 + sort.Search(hi - lo - 1, func(i int) bool { return a[lo + 1 + i] >= value })
+}
+
 // func searchBytes(a []Key, value Key) int {
 //     // Optimize for elements and the last element.
 //     n := len(a)
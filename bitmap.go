@@ -0,0 +1,347 @@
+package bundledb
+
+import (
+    "errors"
+    "math/bits"
+)
+
+const (
+    BITMAP_PAGE_BYTES = 128
+    bitmapPageBits = BITMAP_PAGE_BYTES * 8
+    headerBitmapPrim = byte(90)
+    headerBitmapPointer = byte(91)
+    headerBitmapDense = byte(92)
+    // How many result pages BitOp holds before writing them.
+    bitOpBatchPages = 64
+)
+
+var (
+    InvalidBitOp = errors.New("BitOp needs one source for BitNot and at least one source otherwise")
+)
+
+type BitOpType int
+
+const (
+    BitAnd BitOpType = iota
+    BitOr
+    BitXor
+    BitNot
+)
+
+// A Bitmap stores bits at Key offsets. Bits are grouped into pages of BITMAP_PAGE_BYTES which are the values of a Map,
+// so a sparse bitmap only stores the pages that have a bit set. Pages that become all zero are deleted.
+type Bitmap struct {
+    pages *Map
+}
+
+func bitmapFromBundle(bund *Bundle) (*Bitmap, error) {
+    m, err := mapFromBundle(bund)
+    if err != nil {
+        return nil, err
+    }
+    return &Bitmap{m}, nil
+}
+
+func bitmapLocation(offset Key) (Key, int) {
+    return offset / bitmapPageBits, int(offset % bitmapPageBits)
+}
+
+func pageBit(page []byte, bit int) bool {
+    return page[bit / 8] & (0x80 >> uint(bit % 8)) != 0
+}
+
+func pageIsEmpty(page []byte) bool {
+    for _, b := range page {
+        if b != 0 {
+            return false
+        }
+    }
+    return true
+}
+
+// Fetch a writable copy of a page. Missing pages are all zero.
+func (bm *Bitmap) page(pageKey Key) ([]byte, bool, error) {
+    page := make([]byte, BITMAP_PAGE_BYTES)
+    val, exists, err := bm.pages.Lookup(pageKey)
+    if err != nil {
+        return nil, false, err
+    }
+    copy(page, val)
+    return page, exists, nil
+}
+
+func (bm *Bitmap) putPage(pageKey Key, page []byte) error {
+    var err error
+    if pageIsEmpty(page) {
+        _, err = bm.pages.Delete(pageKey)
+    } else {
+        _, err = bm.pages.Insert(pageKey, page)
+    }
+    return err
+}
+
+// Set the bit at `offset`, returning its previous value.
+func (bm *Bitmap) SetBit(offset Key, value bool) (bool, error) {
+    pageKey, bit := bitmapLocation(offset)
+    page, _, err := bm.page(pageKey)
+    if err != nil {
+        return false, err
+    }
+    old := pageBit(page, bit)
+    if old == value {
+        return old, nil
+    }
+    if value {
+        page[bit / 8] |= 0x80 >> uint(bit % 8)
+    } else {
+        page[bit / 8] &^= 0x80 >> uint(bit % 8)
+    }
+    return old, bm.putPage(pageKey, page)
+}
+
+func (bm *Bitmap) GetBit(offset Key) (bool, error) {
+    pageKey, bit := bitmapLocation(offset)
+    val, exists, err := bm.pages.Lookup(pageKey)
+    if err != nil || !exists || bit / 8 >= len(val) {
+        return false, err
+    }
+    return pageBit(val, bit), nil
+}
+
+// Count the set bits with offsets between `start` and `end` inclusive.
+func (bm *Bitmap) BitCount(start, end Key) (int, error) {
+    if start > end {
+        return 0, nil
+    }
+    startPage, startBit := bitmapLocation(start)
+    endPage, endBit := bitmapLocation(end)
+    it, err := bm.pages.Iterator()
+    if err != nil {
+        return 0, err
+    }
+    count := 0
+    for it.Seek(startPage); it.IsValid() && it.Key() <= endPage; it.Next() {
+        pageKey := it.Key()
+        val, _, err := bm.pages.Lookup(pageKey)
+        if err != nil {
+            return 0, err
+        }
+        lo, hi := 0, bitmapPageBits - 1
+        if pageKey == startPage {
+            lo = startBit
+        }
+        if pageKey == endPage {
+            hi = endBit
+        }
+        count += countPageBits(val, lo, hi)
+    }
+    return count, nil
+}
+
+func countPageBits(page []byte, lo, hi int) int {
+    count := 0
+    for lo <= hi && lo % 8 != 0 {
+        if pageBit(page, lo) {
+            count++
+        }
+        lo++
+    }
+    for ; lo + 7 <= hi; lo += 8 {
+        count += bits.OnesCount8(page[lo / 8])
+    }
+    for ; lo <= hi; lo++ {
+        if pageBit(page, lo) {
+            count++
+        }
+    }
+    return count
+}
+
+// Find the first offset at or after `start` whose bit equals `bit`. Searching for a set bit returns false if there is none.
+// Searching for a clear bit always succeeds since bits past the last page are clear.
+func (bm *Bitmap) BitPos(bit bool, start Key) (Key, bool, error) {
+    startPage, startBit := bitmapLocation(start)
+    it, err := bm.pages.Iterator()
+    if err != nil {
+        return 0, false, err
+    }
+    expected := startPage
+    for it.Seek(startPage); it.IsValid(); it.Next() {
+        pageKey := it.Key()
+        if !bit && pageKey > expected {
+            break
+        }
+        val, _, err := bm.pages.Lookup(pageKey)
+        if err != nil {
+            return 0, false, err
+        }
+        lo := 0
+        if pageKey == startPage {
+            lo = startBit
+        }
+        for ii := lo; ii < bitmapPageBits; ii++ {
+            if pageBit(val, ii) == bit {
+                return pageKey * bitmapPageBits + Key(ii), true, nil
+            }
+        }
+        expected = pageKey + 1
+    }
+    if bit {
+        return 0, false, nil
+    }
+    if expected == startPage {
+        return start, true, nil
+    }
+    return expected * bitmapPageBits, true, nil
+}
+
+// Every key between `start` and `end` inclusive, for the pages BitNot fills in.
+type spanIterator struct {
+    start Key
+    end Key
+    key Key
+    done bool
+}
+func (it *spanIterator) IsValid() bool { return !it.done && it.key <= it.end }
+func (it *spanIterator) Key() Key { return it.key }
+func (it *spanIterator) Next() {
+    if it.key == it.end {
+        it.done = true
+    } else {
+        it.key++
+    }
+}
+func (it *spanIterator) Seek(key Key) {
+    if key < it.start {
+        key = it.start
+    }
+    it.key, it.done = key, false
+}
+
+// The page `pageKey` of the result of `op` over `srcs`.
+func bitOpPage(op BitOpType, srcs []*Bitmap, pageKey Key) ([]byte, error) {
+    page, _, err := srcs[0].page(pageKey)
+    if err != nil {
+        return nil, err
+    }
+    if op == BitNot {
+        for ii := range page {
+            page[ii] = ^page[ii]
+        }
+        return page, nil
+    }
+    for _, src := range srcs[1:] {
+        other, _, err := src.pages.Lookup(pageKey)
+        if err != nil {
+            return nil, err
+        }
+        for ii := range page {
+            var o byte
+            if ii < len(other) {
+                o = other[ii]
+            }
+            switch op {
+            case BitAnd:
+                page[ii] &= o
+            case BitOr:
+                page[ii] |= o
+            case BitXor:
+                page[ii] ^= o
+            }
+        }
+    }
+    return page, nil
+}
+
+// Combine `srcs` with `op` and replace the contents of `dest` with the result. BitNot takes exactly one source and
+// flips every bit up to the end of the source's last page. `dest` may also be one of the sources. Pages are visited in
+// order through the set algebra over the page keys, BitAnd only visiting the pages every source has, and at most
+// bitOpBatchPages are held at once.
+func (bm *Bitmap) BitOp(op BitOpType, srcs ...*Bitmap) error {
+    if len(srcs) == 0 || op < BitAnd || op > BitNot || (op == BitNot && len(srcs) != 1) {
+        return InvalidBitOp
+    }
+    its := make([]BundleIterator, len(srcs))
+    for ii, src := range srcs {
+        it, err := src.pages.Iterator()
+        if err != nil {
+            return err
+        }
+        its[ii] = it
+    }
+    dest, err := bm.pages.Iterator()
+    if err != nil {
+        return err
+    }
+
+    // The pages of `dest` are visited too, so the ones missing from the result are deleted.
+    var candidates BundleIterator
+    // BitNot fills the pages up to the source's last one and clears the rest.
+    filled, last := false, Key(0)
+    switch op {
+    case BitAnd:
+        candidates = Union(Intersect(its...), dest)
+    case BitNot:
+        last, filled, err = srcs[0].pages.bund.Floor(MaxKey)
+        if err != nil {
+            return err
+        }
+        candidates = dest
+        if filled {
+            candidates = Union(&spanIterator{start: MinKey, end: last}, dest)
+        }
+    default:
+        candidates = Union(append(its, dest)...)
+    }
+
+    // Writing to `dest` can move the iterators, so each batch is read before it is written and the next one is found
+    // with a fresh Seek.
+    batch := make([]Key, 0, bitOpBatchPages)
+    pages := make([][]byte, 0, bitOpBatchPages)
+    for candidates.Seek(MinKey); candidates.IsValid(); {
+        batch, pages = batch[:0], pages[:0]
+        for ; candidates.IsValid() && len(batch) < bitOpBatchPages; candidates.Next() {
+            batch = append(batch, candidates.Key())
+        }
+        if err := IterErr(candidates); err != nil {
+            return err
+        }
+        for _, k := range batch {
+            if op == BitNot && (!filled || k > last) {
+                pages = append(pages, nil)
+                continue
+            }
+            page, err := bitOpPage(op, srcs, k)
+            if err != nil {
+                return err
+            }
+            pages = append(pages, page)
+        }
+        for ii, k := range batch {
+            if err := bm.putPage(k, pages[ii]); err != nil {
+                return err
+            }
+        }
+        end := batch[len(batch) - 1]
+        if end == MaxKey {
+            break
+        }
+        candidates.Seek(end + 1)
+    }
+    return IterErr(candidates)
+}
+
+type RootBitmap struct {
+    *Bitmap
+    root *Root
+}
+func bitmapFromRoot(root *Root) (*RootBitmap, error) {
+    m, err := bitmapFromBundle(root.Bundle)
+    return &RootBitmap{m, root}, err
+}
+func (m *RootBitmap) Commit() error {
+    return m.root.Commit()
+}
+func (m *RootBitmap) Close() {
+    m.root.Close()
+}
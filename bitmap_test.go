@@ -0,0 +1,165 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestBitmapSetGet(t *testing.T) {
+    offsets := []Key{0, 7, 8, bitmapPageBits - 1, bitmapPageBits, bitmapPageBits * 30 + 5, Key(1) << 40}
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            bm, _ := GetRootBitmap(Key(0), txn)
+            defer bm.Close()
+
+            for _, o := range offsets {
+                old, err := bm.SetBit(o, true)
+                require.NoError(t, err)
+                require.False(t, old)
+            }
+            old, err := bm.SetBit(Key(7), true)
+            require.NoError(t, err)
+            require.True(t, old)
+            return bm.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            bm, _ := GetRootBitmap(Key(0), txn)
+            defer bm.Close()
+
+            for _, o := range offsets {
+                v, err := bm.GetBit(o)
+                require.NoError(t, err)
+                require.True(t, v)
+            }
+            v, err := bm.GetBit(Key(1))
+            require.NoError(t, err)
+            require.False(t, v)
+
+            count, err := bm.BitCount(MinKey, MaxKey)
+            require.NoError(t, err)
+            require.Equal(t, len(offsets), count)
+            count, err = bm.BitCount(Key(7), bitmapPageBits)
+            require.NoError(t, err)
+            require.Equal(t, 4, count)
+            count, err = bm.BitCount(Key(1), Key(6))
+            require.NoError(t, err)
+            require.Equal(t, 0, count)
+
+            pos, found, err := bm.BitPos(true, Key(9))
+            require.NoError(t, err)
+            require.True(t, found)
+            require.Equal(t, Key(bitmapPageBits - 1), pos)
+            pos, found, err = bm.BitPos(true, Key(1) << 40 + 1)
+            require.NoError(t, err)
+            require.False(t, found)
+            pos, _, err = bm.BitPos(false, Key(0))
+            require.NoError(t, err)
+            require.Equal(t, Key(1), pos)
+            pos, _, err = bm.BitPos(false, Key(bitmapPageBits * 2 + 3))
+            require.NoError(t, err)
+            require.Equal(t, Key(bitmapPageBits * 2 + 3), pos)
+
+            // Clearing the only bit of a page deletes the page.
+            old, err := bm.SetBit(bitmapPageBits * 30 + 5, false)
+            require.NoError(t, err)
+            require.True(t, old)
+            it, err := bm.pages.Iterator()
+            require.NoError(t, err)
+            require.Equal(t, 3, len(Collect(it, -1)))
+            return bm.Commit()
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestBitOp(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            a, _ := root.FindBitmap(Key(1))
+            b, _ := root.FindBitmap(Key(2))
+            dest, _ := root.FindBitmap(Key(3))
+            for _, o := range []Key{1, 2, bitmapPageBits * 5} {
+                a.SetBit(o, true)
+            }
+            for _, o := range []Key{2, 3, bitmapPageBits * 9} {
+                b.SetBit(o, true)
+            }
+            dest.SetBit(bitmapPageBits * 100, true)
+
+            checkBits := func(expected ...Key) {
+                count, err := dest.BitCount(MinKey, MaxKey)
+                require.NoError(t, err)
+                require.Equal(t, len(expected), count)
+                for _, o := range expected {
+                    v, _ := dest.GetBit(o)
+                    require.True(t, v)
+                }
+            }
+
+            require.NoError(t, dest.BitOp(BitAnd, a, b))
+            checkBits(2)
+            require.NoError(t, dest.BitOp(BitOr, a, b))
+            checkBits(1, 2, 3, bitmapPageBits * 5, bitmapPageBits * 9)
+            require.NoError(t, dest.BitOp(BitXor, a, b))
+            checkBits(1, 3, bitmapPageBits * 5, bitmapPageBits * 9)
+
+            require.NoError(t, dest.BitOp(BitNot, a))
+            count, _ := dest.BitCount(MinKey, MaxKey)
+            require.Equal(t, bitmapPageBits * 6 - 3, count)
+            v, _ := dest.GetBit(Key(0))
+            require.True(t, v)
+            v, _ = dest.GetBit(Key(1))
+            require.False(t, v)
+
+            require.Equal(t, InvalidBitOp, dest.BitOp(BitNot, a, b))
+            require.Equal(t, InvalidBitOp, dest.BitOp(BitAnd))
+            return root.Commit()
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestBitOpManyPages(t *testing.T) {
+    num := bitOpBatchPages * 3
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            a, _ := root.FindBitmap(Key(1))
+            b, _ := root.FindBitmap(Key(2))
+            for x := 0; x < num; x++ {
+                a.SetBit(Key(x) * bitmapPageBits, true)
+                if x % 2 == 0 {
+                    b.SetBit(Key(x) * bitmapPageBits + 1, true)
+                    b.SetBit(Key(x) * bitmapPageBits, true)
+                }
+            }
+
+            // `a` is both a source and the destination, across several batches.
+            require.NoError(t, a.BitOp(BitAnd, a, b))
+            count, err := a.BitCount(MinKey, MaxKey)
+            require.NoError(t, err)
+            require.Equal(t, num / 2, count)
+            v, _ := a.GetBit(Key(num - 1) * bitmapPageBits)
+            require.False(t, v)
+
+            require.NoError(t, a.BitOp(BitOr, a, b))
+            count, err = a.BitCount(MinKey, MaxKey)
+            require.NoError(t, err)
+            require.Equal(t, num, count)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+    })
+}
@@ -0,0 +1,384 @@
+package bundledb
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "io"
+    "github.com/hansonkd/bundledb/store"
+)
+
+const (
+    BLOB_CHUNK_BYTES = 32 * 1024
+    headerUserBlob = byte(2)
+    blobRefBytes = 1 + KeyLength + 8
+    // Values written with Map.Insert, Map.Update, List.LPush or List.RPush over this size are stored as blobs.
+    MAX_INLINE_VALUE_BYTES = MAX_EMBEDDED_MAP_BYTES
+)
+
+var (
+    NotABlob = errors.New("Value is not a blob")
+    BlobClosed = errors.New("Blob writer is already closed")
+)
+
+// The reference left in a primitive for a blob. Only the ID and size are embedded, the contents live in their own rows.
+type blobRef struct {
+    id Key
+    size int64
+}
+func (v blobRef) Size() int { return blobRefBytes }
+func (v blobRef) Bytes() []byte {
+    b := append([]byte{headerUserBlob}, v.id.Bytes()...)
+    size := make([]byte, 8)
+    binary.BigEndian.PutUint64(size, uint64(v.size))
+    return append(b, size...)
+}
+func (v blobRef) Serialize(w *bytes.Buffer) int {
+    w.Write(v.Bytes())
+    return blobRefBytes
+}
+
+func blobRefFromBytes(b []byte) (blobRef, bool) {
+    if len(b) != blobRefBytes || b[0] != headerUserBlob {
+        return blobRef{}, false
+    }
+    return blobRef{BytesToKey(b[1:1 + KeyLength]), int64(binary.BigEndian.Uint64(b[1 + KeyLength:]))}, true
+}
+
+func rawBytes(v Value) []byte {
+    if v == nil {
+        return nil
+    }
+    return v.Bytes()
+}
+
+func blobPrefix(id Key) []byte {
+    return append([]byte{tableBlob}, id.Bytes()...)
+}
+
+func blobChunkKey(id Key, chunk int64) []byte {
+    return append(blobPrefix(id), Key(chunk).Bytes()...)
+}
+
+// Rows of the blob index are the path of a blob's entry with the blob's ID as the value, so the blobs under a range
+// of keys are found without reading the shards holding them. An entry's path starts with the path of the bundle
+// holding it, so the blobs of a nested bundle sort right after the key it is stored under.
+func blobIndexKey(path []Key) []byte {
+    b := []byte{tableBlobIndex}
+    for _, k := range path {
+        b = append(b, k.Bytes()...)
+    }
+    return b
+}
+
+// Store the reference to a blob at `path` in the index.
+func indexBlob(txn *store.Txn, path []Key, ref blobRef) error {
+    return txn.Set(blobIndexKey(path), ref.id.Bytes())
+}
+
+// Drop the chunks of the blob `ref` at `path` and its index row.
+func dropBlobAt(txn *store.Txn, path []Key, ref blobRef) error {
+    if err := txn.Delete(blobIndexKey(path)); err != nil {
+        return err
+    }
+    return dropShards(txn, blobPrefix(ref.id))
+}
+
+// Drop every blob the index has under the bundle at `path` with a key between `start` and `end` inclusive,
+// including the blobs of bundles nested under those keys. Only the index is read.
+func dropIndexedBlobs(txn *store.Txn, path []Key, start, end Key) error {
+    prefix := blobIndexKey(path)
+    it := txn.NewIterator(&store.IteratorOptions{Prefix: prefix, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), Offset: 0, RangeType: store.RangeClose, Count: -1})
+    rows, ids := [][]byte{}, []Key{}
+    for it.Seek(start.Bytes()); it.Valid(); it.Next() {
+        row := txn.TrimDomain(it.Item().KeyCopy(nil))
+        if BytesToKey(row[len(prefix):len(prefix) + KeyLength]) > end {
+            break
+        }
+        id, err := it.Item().Value()
+        if err != nil {
+            it.Close()
+            return err
+        }
+        rows = append(rows, row)
+        ids = append(ids, BytesToKey(id))
+    }
+    it.Close()
+    for ii, row := range rows {
+        if err := txn.Delete(row); err != nil {
+            return err
+        }
+        if err := dropShards(txn, blobPrefix(ids[ii])); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// A Blob is a large value stored out of line in chunks of BLOB_CHUNK_BYTES. It implements io.ReaderAt so ranges
+// can be read without fetching the whole value.
+type Blob struct {
+    txn *store.Txn
+    ref blobRef
+}
+
+// Length of the blob in bytes.
+func (b *Blob) Size() int64 { return b.ref.size }
+
+func (b *Blob) ReadAt(p []byte, off int64) (int, error) {
+    if off < 0 {
+        return 0, io.EOF
+    }
+    n := 0
+    for n < len(p) && off < b.ref.size {
+        chunk := off / BLOB_CHUNK_BYTES
+        item, err := b.txn.Get(blobChunkKey(b.ref.id, chunk))
+        if err != nil {
+            return n, err
+        }
+        val, err := item.Value()
+        if err != nil {
+            return n, err
+        }
+        start := int(off % BLOB_CHUNK_BYTES)
+        if start >= len(val) {
+            return n, io.ErrUnexpectedEOF
+        }
+        copied := copy(p[n:], val[start:])
+        n += copied
+        off += int64(copied)
+    }
+    if n < len(p) {
+        return n, io.EOF
+    }
+    return n, nil
+}
+
+// Stream the whole blob.
+func (b *Blob) Reader() io.Reader {
+    return io.NewSectionReader(b, 0, b.ref.size)
+}
+
+// Read `n` bytes starting at `off`. The result is shorter if the blob ends first.
+func (b *Blob) ReadRange(off int64, n int) ([]byte, error) {
+    if off >= b.ref.size {
+        return []byte{}, nil
+    }
+    if rest := b.ref.size - off; int64(n) > rest {
+        n = int(rest)
+    }
+    p := make([]byte, n)
+    read, err := b.ReadAt(p, off)
+    if err == io.EOF {
+        err = nil
+    }
+    return p[:read], err
+}
+
+// Read the whole blob into memory.
+func (b *Blob) Bytes() ([]byte, error) {
+    return b.ReadRange(0, int(b.ref.size))
+}
+
+// A BlobWriter writes chunks as they fill up. The reference is only written to the collection on Close, so an
+// unclosed writer leaves the previous value in place.
+type BlobWriter struct {
+    txn *store.Txn
+    ref blobRef
+    buf []byte
+    chunk int64
+    closed bool
+    onClose func(blobRef) error
+}
+
+func newBlobWriter(txn *store.Txn, onClose func(blobRef) error) *BlobWriter {
+    return &BlobWriter{
+        txn: txn,
+        ref: blobRef{id: BytesToKey(txn.NextShardSeq()[:8])},
+        buf: make([]byte, 0, BLOB_CHUNK_BYTES),
+        onClose: onClose,
+    }
+}
+
+// Store `b` as a new blob, returning its reference.
+func writeBlob(txn *store.Txn, b []byte) (blobRef, error) {
+    var ref blobRef
+    w := newBlobWriter(txn, func(r blobRef) error {
+        ref = r
+        return nil
+    })
+    if _, err := w.Write(b); err != nil {
+        return ref, err
+    }
+    return ref, w.Close()
+}
+
+func (w *BlobWriter) Write(p []byte) (int, error) {
+    if w.closed {
+        return 0, BlobClosed
+    }
+    n := 0
+    for len(p) > 0 {
+        take := BLOB_CHUNK_BYTES - len(w.buf)
+        if take > len(p) {
+            take = len(p)
+        }
+        w.buf = append(w.buf, p[:take]...)
+        p = p[take:]
+        n += take
+        if len(w.buf) == BLOB_CHUNK_BYTES {
+            if err := w.flush(); err != nil {
+                return n, err
+            }
+        }
+    }
+    return n, nil
+}
+
+func (w *BlobWriter) flush() error {
+    if len(w.buf) == 0 {
+        return nil
+    }
+    if err := w.txn.Set(blobChunkKey(w.ref.id, w.chunk), append([]byte{}, w.buf...)); err != nil {
+        return err
+    }
+    w.ref.size += int64(len(w.buf))
+    w.chunk++
+    w.buf = w.buf[:0]
+    return nil
+}
+
+// Write the last chunk and store the reference.
+func (w *BlobWriter) Close() error {
+    if w.closed {
+        return BlobClosed
+    }
+    w.closed = true
+    if err := w.flush(); err != nil {
+        return err
+    }
+    return w.onClose(w.ref)
+}
+
+// The value to store for `val`: the value itself, or a new blob once it's over MAX_INLINE_VALUE_BYTES.
+func inlineOrBlob(txn *store.Txn, val []byte) (Value, error) {
+    if len(val) > MAX_INLINE_VALUE_BYTES {
+        return writeBlob(txn, val)
+    }
+    return UserVal(val), nil
+}
+
+// Drop the chunks of `val` at `path` if it refers to a blob.
+func dropBlobOf(txn *store.Txn, path []Key, val Value) error {
+    if ref, ok := blobRefFromBytes(rawBytes(val)); ok {
+        return dropBlobAt(txn, path, ref)
+    }
+    return nil
+}
+
+// The contents of a stored value without its header, reading a blob in full.
+func storedBytes(txn *store.Txn, val Value) ([]byte, error) {
+    if ref, ok := blobRefFromBytes(rawBytes(val)); ok {
+        return (&Blob{txn, ref}).Bytes()
+    }
+    return val.Bytes()[1:], nil
+}
+
+func (m *Map) blobRef(key Key) (blobRef, bool, error) {
+    val, exists, err := m.bund.Read(key)
+    if err != nil || !exists || val == nil {
+        return blobRef{}, false, err
+    }
+    ref, ok := blobRefFromBytes(val.Bytes())
+    return ref, ok, nil
+}
+
+// Start writing a blob under `key`. It replaces the current value when the writer is closed.
+func (m *Map) CreateBlob(key Key) (*BlobWriter, error) {
+    return newBlobWriter(m.bund.txn, func(ref blobRef) error {
+        if err := m.dropBlob(key); err != nil {
+            return err
+        }
+        _, err := m.writeBlobRef(key, ref)
+        return err
+    }), nil
+}
+
+func (m *Map) path(key Key) []Key {
+    return append(append([]Key{}, m.bund.rootPath...), key)
+}
+
+// Write `ref` under `key` and add it to the blob index.
+func (m *Map) writeBlobRef(key Key, ref blobRef) (bool, error) {
+    exists, err := m.bund.Write(key, ref)
+    if err != nil {
+        return exists, err
+    }
+    return exists, indexBlob(m.bund.txn, m.path(key), ref)
+}
+
+// Drop the chunks of the blob under `key` before its value is overwritten or deleted.
+func (m *Map) dropBlob(key Key) error {
+    ref, exists, err := m.blobRef(key)
+    if err != nil || !exists {
+        return err
+    }
+    return dropBlobAt(m.bund.txn, m.path(key), ref)
+}
+
+// Drop the chunks of every blob between `start` and `end` inclusive, finding them in the blob index.
+func (m *Map) dropBlobsIn(start, end Key) error {
+    return dropIndexedBlobs(m.bund.txn, m.bund.rootPath, start, end)
+}
+
+// Copy everything from `r` into a blob under `key`, returning the number of bytes written.
+func (m *Map) InsertBlob(key Key, r io.Reader) (int64, error) {
+    w, err := m.CreateBlob(key)
+    if err != nil {
+        return 0, err
+    }
+    n, err := io.Copy(w, r)
+    if err != nil {
+        return n, err
+    }
+    return n, w.Close()
+}
+
+// Open the blob under `key`. Returns NotABlob if `key` holds a regular value.
+func (m *Map) OpenBlob(key Key) (*Blob, bool, error) {
+    val, exists, err := m.bund.Read(key)
+    if err != nil || !exists || val == nil {
+        return nil, false, err
+    }
+    ref, ok := blobRefFromBytes(val.Bytes())
+    if !ok {
+        return nil, false, NotABlob
+    }
+    return &Blob{m.bund.txn, ref}, true, nil
+}
+
+// Delete `key` along with the chunks of its blob. The same as Map.Delete.
+func (m *Map) DeleteBlob(key Key) (bool, error) {
+    return m.Delete(key)
+}
+
+func (d *List) pushBlob(r io.Reader, push func(Value) error) (int64, error) {
+    w := newBlobWriter(d.bund.txn, func(ref blobRef) error {
+        return push(ref)
+    })
+    n, err := io.Copy(w, r)
+    if err != nil {
+        return n, err
+    }
+    return n, w.Close()
+}
+
+// Copy everything from `r` into a blob pushed onto the left of the list. Peeks and pops read it in full.
+func (d *List) LPushBlob(r io.Reader) (int64, error) {
+    return d.pushBlob(r, d.lpush)
+}
+
+// Copy everything from `r` into a blob pushed onto the right of the list. Peeks and pops read it in full.
+func (d *List) RPushBlob(r io.Reader) (int64, error) {
+    return d.pushBlob(r, d.rpush)
+}
@@ -0,0 +1,259 @@
+package bundledb
+
+import (
+    "bytes"
+    "io/ioutil"
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestBlob(t *testing.T) {
+    data := make([]byte, BLOB_CHUNK_BYTES * 3 + 100)
+    for ii := range data {
+        data[ii] = byte(ii % 251)
+    }
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+
+            n, err := m.InsertBlob(Key(1), bytes.NewReader(data))
+            require.NoError(t, err)
+            require.Equal(t, int64(len(data)), n)
+            _, err = m.Insert(Key(2), []byte("small"))
+            require.NoError(t, err)
+
+            // Writes in odd sized pieces still chunk correctly.
+            w, err := m.CreateBlob(Key(3))
+            require.NoError(t, err)
+            for ii := 0; ii < len(data); ii += 1000 {
+                end := ii + 1000
+                if end > len(data) {
+                    end = len(data)
+                }
+                _, err = w.Write(data[ii:end])
+                require.NoError(t, err)
+            }
+            require.NoError(t, w.Close())
+            require.Equal(t, BlobClosed, w.Close())
+            return m.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+
+            blob, exists, err := m.OpenBlob(Key(1))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, int64(len(data)), blob.Size())
+            all, err := ioutil.ReadAll(blob.Reader())
+            require.NoError(t, err)
+            require.Equal(t, data, all)
+
+            // A range spanning a chunk boundary.
+            part, err := blob.ReadRange(BLOB_CHUNK_BYTES - 10, 20)
+            require.NoError(t, err)
+            require.Equal(t, data[BLOB_CHUNK_BYTES - 10:BLOB_CHUNK_BYTES + 10], part)
+            part, err = blob.ReadRange(int64(len(data) - 5), 20)
+            require.NoError(t, err)
+            require.Equal(t, data[len(data) - 5:], part)
+
+            val, exists, err := m.Lookup(Key(3))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, data, val)
+
+            _, _, err = m.OpenBlob(Key(2))
+            require.Equal(t, NotABlob, err)
+
+            _, err = m.InsertBlob(Key(3), bytes.NewReader([]byte("replaced")))
+            require.NoError(t, err)
+            exists, err = m.DeleteBlob(Key(1))
+            require.NoError(t, err)
+            require.True(t, exists)
+            return m.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+
+            _, exists, err := m.OpenBlob(Key(1))
+            require.NoError(t, err)
+            require.False(t, exists)
+            val, _, err := m.Lookup(Key(3))
+            require.NoError(t, err)
+            require.Equal(t, []byte("replaced"), val)
+
+            // Only the chunk of the replacement blob is left.
+            it := txn.NewIterator(&store.IteratorOptions{Prefix: []byte{tableBlob}, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), RangeType: store.RangeClose, Count: -1})
+            defer it.Close()
+            rows := 0
+            for it.Start(); it.Valid(); it.Next() {
+                rows++
+            }
+            require.Equal(t, 1, rows)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestBlobChunksDropped(t *testing.T) {
+    data := make([]byte, BLOB_CHUNK_BYTES * 2 + 10)
+    for ii := range data {
+        data[ii] = byte(ii % 251)
+    }
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            for x := 1; x <= 6; x++ {
+                _, err = m.InsertBlob(Key(x), bytes.NewReader(data))
+                require.NoError(t, err)
+            }
+            return m.Commit()
+        })
+        require.NoError(t, err)
+        require.Equal(t, 6 * 3, tableRows(t, db, tableBlob))
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            _, err = m.Insert(Key(1), []byte("small"))
+            require.NoError(t, err)
+            _, err = m.Delete(Key(2))
+            require.NoError(t, err)
+            _, val, exists, err := m.PopMax()
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, data, val)
+            require.NoError(t, m.DeleteRange(Key(3), Key(4)))
+            return m.Commit()
+        })
+        require.NoError(t, err)
+        // Only the blob under Key(5) is left.
+        require.Equal(t, 3, tableRows(t, db, tableBlob))
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            l, err := GetRootList(Key(1), txn)
+            require.NoError(t, err)
+            defer l.Close()
+            require.NoError(t, l.RPush([]byte("a")))
+            n, err := l.RPushBlob(bytes.NewReader(data))
+            require.NoError(t, err)
+            require.Equal(t, int64(len(data)), n)
+            _, err = l.LPushBlob(bytes.NewReader(data[:10]))
+            require.NoError(t, err)
+            return l.Commit()
+        })
+        require.NoError(t, err)
+        require.Equal(t, 3 + 3 + 1, tableRows(t, db, tableBlob))
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            l, err := GetRootList(Key(1), txn)
+            require.NoError(t, err)
+            defer l.Close()
+            val, exists, err := l.RPeek(Key(0))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, data, val)
+            val, _, err = l.LPeek(Key(1))
+            require.NoError(t, err)
+            require.Equal(t, []byte("a"), val)
+
+            val, exists, err = l.RPop()
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, data, val)
+            val, exists, err = l.LPop()
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, data[:10], val)
+            return l.Commit()
+        })
+        require.NoError(t, err)
+        require.Equal(t, 3, tableRows(t, db, tableBlob))
+    })
+}
+
+func TestLargeValuesOutOfLine(t *testing.T) {
+    big := bytes.Repeat([]byte("x"), BLOB_CHUNK_BYTES + 1)
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            m, err := root.FindMap(Key(1))
+            require.NoError(t, err)
+            _, err = m.Insert(Key(1), big)
+            require.NoError(t, err)
+            _, err = m.Insert(Key(2), make([]byte, MAX_INLINE_VALUE_BYTES))
+            require.NoError(t, err)
+            blob, exists, err := m.OpenBlob(Key(1))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, int64(len(big)), blob.Size())
+            _, _, err = m.OpenBlob(Key(2))
+            require.Equal(t, NotABlob, err)
+
+            // Growing a value past the limit moves it out of line too.
+            require.NoError(t, m.Update(Key(2), func(old []byte, exists bool) ([]byte, bool) {
+                return append(old, 'x'), false
+            }))
+            _, exists, err = m.OpenBlob(Key(2))
+            require.NoError(t, err)
+            require.True(t, exists)
+
+            nested, err := root.FindMap(Key(2), Key(3))
+            require.NoError(t, err)
+            _, err = nested.Insert(Key(1), big)
+            require.NoError(t, err)
+
+            l, err := root.FindList(Key(3))
+            require.NoError(t, err)
+            require.NoError(t, l.RPush(big))
+            val, exists, err := l.LPeek(Key(0))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, big, val)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+        require.Equal(t, 2 + 1 + 2 + 2, tableRows(t, db, tableBlob))
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+            val, exists, err := root.Read(Key(1))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.True(t, val.Size() < MAX_INLINE_VALUE_BYTES)
+
+            // Deleting a child releases its blobs and those of the bundles nested in it.
+            for _, key := range []Key{Key(1), Key(2), Key(3)} {
+                _, err = root.DeleteChild(key)
+                require.NoError(t, err)
+            }
+            return root.Commit()
+        })
+        require.NoError(t, err)
+        require.Equal(t, 0, tableRows(t, db, tableBlob))
+        require.Equal(t, 0, tableRows(t, db, tableBlobIndex))
+    })
+}
@@ -0,0 +1,105 @@
+package bundledb
+
+// The entry with the largest key at or before `key`. Expired entries are skipped.
+func (m *Map) Floor(key Key) (Key, []byte, bool, error) {
+    for {
+        found, ok, err := m.bund.Floor(key)
+        if err != nil || !ok {
+            return 0, nil, false, err
+        }
+        val, exists, err := m.Lookup(found)
+        if err != nil || exists {
+            return found, val, exists, err
+        }
+        if found == MinKey {
+            return 0, nil, false, nil
+        }
+        key = found - 1
+    }
+}
+
+// The entry with the smallest key at or after `key`. Expired entries are skipped.
+func (m *Map) Ceiling(key Key) (Key, []byte, bool, error) {
+    for {
+        found, ok, err := m.bund.Ceiling(key)
+        if err != nil || !ok {
+            return 0, nil, false, err
+        }
+        val, exists, err := m.Lookup(found)
+        if err != nil || exists {
+            return found, val, exists, err
+        }
+        if found == MaxKey {
+            return 0, nil, false, nil
+        }
+        key = found + 1
+    }
+}
+
+// The entry with the smallest key.
+func (m *Map) Min() (Key, []byte, bool, error) {
+    return m.Ceiling(MinKey)
+}
+
+// The entry with the largest key.
+func (m *Map) Max() (Key, []byte, bool, error) {
+    return m.Floor(MaxKey)
+}
+
+// Remove and return the entry with the smallest key.
+func (m *Map) PopMin() (Key, []byte, bool, error) {
+    return m.pop(m.Min)
+}
+
+// Remove and return the entry with the largest key.
+func (m *Map) PopMax() (Key, []byte, bool, error) {
+    return m.pop(m.Max)
+}
+
+func (m *Map) pop(find func() (Key, []byte, bool, error)) (Key, []byte, bool, error) {
+    key, val, exists, err := find()
+    if err != nil || !exists {
+        return key, val, exists, err
+    }
+    _, err = m.Delete(key)
+    return key, val, true, err
+}
+
+// The largest member at or before `key`.
+func (m *Set) Floor(key Key) (Key, bool, error) {
+    return m.bund.Floor(key)
+}
+
+// The smallest member at or after `key`.
+func (m *Set) Ceiling(key Key) (Key, bool, error) {
+    return m.bund.Ceiling(key)
+}
+
+// The smallest member.
+func (m *Set) Min() (Key, bool, error) {
+    return m.bund.Ceiling(MinKey)
+}
+
+// The largest member.
+func (m *Set) Max() (Key, bool, error) {
+    return m.bund.Floor(MaxKey)
+}
+
+// Remove and return the smallest member.
+func (m *Set) PopMin() (Key, bool, error) {
+    return m.pop(m.Min)
+}
+
+// Remove and return the largest member.
+func (m *Set) PopMax() (Key, bool, error) {
+    return m.pop(m.Max)
+}
+
+func (m *Set) pop(find func() (Key, bool, error)) (Key, bool, error) {
+    key, exists, err := find()
+    if err != nil || !exists {
+        return key, exists, err
+    }
+    _, err = m.Remove(key)
+    return key, true, err
+}
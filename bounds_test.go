@@ -0,0 +1,83 @@
+package bundledb
+
+import (
+    "fmt"
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestBounds(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 5
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            s, err := GetRootSet(Key(1), txn)
+            require.NoError(t, err)
+            defer s.Close()
+
+            for x := 1; x <= num; x++ {
+                _, err = m.Insert(Key(x * 10), []byte(fmt.Sprintf("%d", x * 10)))
+                require.NoError(t, err)
+                _, err = s.Add(Key(x * 10))
+                require.NoError(t, err)
+            }
+            require.NoError(t, m.Commit())
+            return s.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            s, err := GetRootSet(Key(1), txn)
+            require.NoError(t, err)
+            defer s.Close()
+
+            for x := 1; x < num; x++ {
+                key, val, exists, err := m.Floor(Key(x * 10 + 5))
+                require.NoError(t, err)
+                require.True(t, exists)
+                require.Equal(t, Key(x * 10), key)
+                require.Equal(t, []byte(fmt.Sprintf("%d", x * 10)), val)
+                key, exists, err = s.Ceiling(Key(x * 10 + 5))
+                require.NoError(t, err)
+                require.True(t, exists)
+                require.Equal(t, Key(x * 10 + 10), key)
+            }
+            _, _, exists, err := m.Floor(Key(5))
+            require.NoError(t, err)
+            require.False(t, exists)
+            _, exists, err = s.Ceiling(Key(num * 10 + 1))
+            require.NoError(t, err)
+            require.False(t, exists)
+
+            key, val, exists, err := m.PopMin()
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, Key(10), key)
+            require.Equal(t, []byte("10"), val)
+            key, _, _, err = m.Min()
+            require.NoError(t, err)
+            require.Equal(t, Key(20), key)
+
+            for x := num; x > num - 15; x-- {
+                key, exists, err = s.PopMax()
+                require.NoError(t, err)
+                require.True(t, exists)
+                require.Equal(t, Key(x * 10), key)
+            }
+            key, _, err = s.Max()
+            require.NoError(t, err)
+            require.Equal(t, Key((num - 15) * 10), key)
+            require.NoError(t, m.Commit())
+            return s.Commit()
+        })
+        require.NoError(t, err)
+    })
+}
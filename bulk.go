@@ -0,0 +1,252 @@
+package bundledb
+
+import (
+    "errors"
+    "github.com/hansonkd/bundledb/store"
+)
+
+var (
+    KeysOutOfOrder = errors.New("Bulk loaded keys must be strictly increasing")
+    LoaderClosed = errors.New("Bulk loader is already committed or aborted")
+)
+
+type BulkLoaderOptions struct {
+    // How full to pack each shard, between 0 and 1. Defaults to 0.9 so that a few later inserts don't split them.
+    FillFactor float64
+    // How many shards to write per transaction. Defaults to 1000.
+    ShardsPerTxn int
+}
+
+// A BulkLoader builds a Map or Set from keys given in increasing order, writing full shards straight to the
+// store instead of inserting one key at a time. Shards are written across many transactions under a new shard id
+// and nothing is visible until Commit swaps the root over to them in one transaction, replacing the Map or Set the
+// root held before. A Bloom filter stored with the old Set is rebuilt with the same options from the loaded keys.
+type BulkLoader struct {
+    db *store.DB
+    domain []byte
+    root Key
+    primType Decoder
+    shardId []byte
+    perShard int
+    shardsPerTxn int
+    current Primitive
+    pending []Primitive
+    count int
+    lastKey Key
+    closed bool
+}
+
+func NewMapBulkLoader(db *store.DB, domain []byte, root Key, opts BulkLoaderOptions) *BulkLoader {
+    return newBulkLoader(db, domain, root, DecodeMap, MAX_SHARD_MAP_SIZE, opts)
+}
+
+func NewSetBulkLoader(db *store.DB, domain []byte, root Key, opts BulkLoaderOptions) *BulkLoader {
+    return newBulkLoader(db, domain, root, DecodeSet, MAX_SHARD_SET_SIZE, opts)
+}
+
+func newBulkLoader(db *store.DB, domain []byte, root Key, primType Decoder, maxShard int, opts BulkLoaderOptions) *BulkLoader {
+    if opts.FillFactor <= 0 || opts.FillFactor > 1 {
+        opts.FillFactor = 0.9
+    }
+    if opts.ShardsPerTxn <= 0 {
+        opts.ShardsPerTxn = 1000
+    }
+    perShard := int(float64(maxShard) * opts.FillFactor)
+    if perShard < 1 {
+        perShard = 1
+    }
+    current := primType.NewPrimitive()
+    setOpenMin(current, true)
+    return &BulkLoader{
+        db: db,
+        domain: domain,
+        root: root,
+        primType: primType,
+        perShard: perShard,
+        shardsPerTxn: opts.ShardsPerTxn,
+        current: current,
+    }
+}
+
+// Add `key` with `val` to a Map.
+func (l *BulkLoader) Insert(key Key, val []byte) error {
+    return l.write(key, UserVal(val))
+}
+
+// Add `key` to a Set.
+func (l *BulkLoader) Add(key Key) error {
+    return l.write(key, nil)
+}
+
+// The number of keys added so far.
+func (l *BulkLoader) Count() int {
+    return l.count
+}
+
+func (l *BulkLoader) write(key Key, val Value) error {
+    if l.closed {
+        return LoaderClosed
+    }
+    if l.count > 0 && key <= l.lastKey {
+        return KeysOutOfOrder
+    }
+    // A full shard is only finished once another key arrives, since the last shard has to be stored under MaxKey.
+    if len(l.current.Keys()) >= l.perShard {
+        l.pending = append(l.pending, l.current)
+        l.current = l.primType.NewPrimitive()
+        setOpenMin(l.current, false)
+        if len(l.pending) >= l.shardsPerTxn {
+            if err := l.flush(); err != nil {
+                return err
+            }
+        }
+    }
+    l.current.Write(key, val)
+    l.lastKey = key
+    l.count++
+    return nil
+}
+
+// Only the first shard may hold keys before its smallest key.
+func setOpenMin(prim Primitive, open bool) {
+    switch p := prim.(type) {
+    case *primMap:
+        p.openMin = open
+    case *primSet:
+        p.openMin = open
+    }
+}
+
+// The shard id is picked by the first transaction that writes a shard.
+func (l *BulkLoader) prefix(txn *store.Txn) []byte {
+    if l.shardId == nil {
+        l.shardId = txn.NextShardSeq()[:8]
+    }
+    return append([]byte{l.primType.Table()}, l.shardId...)
+}
+
+func (l *BulkLoader) flush() error {
+    if len(l.pending) == 0 {
+        return nil
+    }
+    err := l.db.Update(l.domain, func(txn *store.Txn) error {
+        for _, prim := range l.pending {
+            if err := commitShard(txn, prim, l.prefix(txn), prim.Max()); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    // Keep the shards on failure so Commit can be retried.
+    if err == nil {
+        l.pending = nil
+    }
+    return err
+}
+
+// Write the remaining shards and point the root at them. The root must be empty or hold the same type of collection.
+// The old shards, blob chunks, expiry index rows and nested collections are released in the same transaction, so a
+// failed Commit leaves the old collection in place. If Commit fails, Abort still drops the shards written so far.
+func (l *BulkLoader) Commit() error {
+    if l.closed {
+        return LoaderClosed
+    }
+    if err := l.flush(); err != nil {
+        return err
+    }
+    var old []byte
+    err := l.db.Update(l.domain, func(txn *store.Txn) error {
+        state, err := readRootState(l.root, txn)
+        if err != nil {
+            return err
+        }
+        if found := storedType(state); len(state) > 0 && found != l.primType.Type() {
+            return &ErrTypeMismatch{Path: []Key{l.root}, Expected: l.primType.Type(), Found: found}
+        }
+        old = state
+        if err := commitShard(txn, l.current, l.prefix(txn), MaxKey); err != nil {
+            return err
+        }
+        ptr := l.current.MakePointer(l.shardId)
+        if setBytesHaveBloom(old) {
+            if ptr, err = l.rebuildBloom(txn, ptr); err != nil {
+                return err
+            }
+        }
+        if err := l.release(txn, old); err != nil {
+            return err
+        }
+        return txn.Set(append([]byte{tableTopLevel}, l.root.Bytes()...), ptr)
+    })
+    if err != nil {
+        return err
+    }
+    l.closed = true
+    return nil
+}
+
+// Release the storage of the collection the root held before.
+func (l *BulkLoader) release(txn *store.Txn, old []byte) error {
+    if len(old) == 0 {
+        return nil
+    }
+    if l.primType.Type() != TypeSet {
+        return releaseValue(txn, []Key{l.root}, old)
+    }
+    // The Bloom filter of a Set was already replaced, so only its shards are left to drop.
+    if DecodeSet.IsPointer(old) {
+        return dropShards(txn, append([]byte{tableSet}, old[1:9]...))
+    }
+    return nil
+}
+
+// Replace the Bloom filter of the old Set with one created with the same options and filled from the loaded keys.
+// Returns the pointer to the new Set, flagged as having a filter.
+func (l *BulkLoader) rebuildBloom(txn *store.Txn, ptr []byte) ([]byte, error) {
+    path := []Key{l.root}
+    state, err := readSetBloom(txn, path)
+    if err != nil {
+        return nil, err
+    }
+    oldBloom, err := newBundle(txn, path, DecodeBloom, state)
+    if err != nil {
+        return nil, err
+    }
+    prim, err := oldBloom.Primitive(MaxKey)
+    oldBloom.close()
+    if err != nil {
+        return nil, err
+    }
+    opts := prim.(*primBloom).opts
+    if err := dropSetBloom(txn, path); err != nil {
+        return nil, err
+    }
+    bund, err := newBundle(txn, path, DecodeSet, ptr)
+    if err != nil {
+        return nil, err
+    }
+    defer bund.close()
+    if _, err := (&Set{bund: bund}).EnableBloom(opts); err != nil {
+        return nil, err
+    }
+    val, err := bund.commit(txn)
+    if err != nil {
+        return nil, err
+    }
+    return val.Bytes(), nil
+}
+
+// Drop the shards written so far and leave the root untouched.
+func (l *BulkLoader) Abort() error {
+    if l.closed {
+        return LoaderClosed
+    }
+    l.closed = true
+    l.pending = nil
+    if l.shardId == nil {
+        return nil
+    }
+    return l.db.Update(l.domain, func(txn *store.Txn) error {
+        return dropShards(txn, l.prefix(txn))
+    })
+}
@@ -0,0 +1,335 @@
+package bundledb
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "testing"
+    "time"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestBulkLoader(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 50
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            for x := 0; x < MAX_SHARD_MAP_SIZE * 3; x++ {
+                _, err = m.Insert(Key(x), []byte("old"))
+                require.NoError(t, err)
+            }
+            return m.Commit()
+        })
+        require.NoError(t, err)
+
+        loader := NewMapBulkLoader(db, []byte("test"), Key(0), BulkLoaderOptions{ShardsPerTxn: 7})
+        for x := 1; x <= num; x++ {
+            require.NoError(t, loader.Insert(Key(x * 2), []byte(fmt.Sprintf("%d", x * 2))))
+        }
+        require.Equal(t, KeysOutOfOrder, loader.Insert(Key(2), nil))
+        // Nothing is visible before Commit.
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            val, _, err := m.Lookup(Key(2))
+            require.NoError(t, err)
+            require.Equal(t, []byte("old"), val)
+            return nil
+        })
+        require.NoError(t, err)
+        require.NoError(t, loader.Commit())
+        require.Equal(t, LoaderClosed, loader.Commit())
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+
+            it, err := m.Iterator()
+            require.NoError(t, err)
+            require.Equal(t, num, len(Collect(it, -1)))
+            for x := 1; x <= num; x++ {
+                val, exists, err := m.Lookup(Key(x * 2))
+                require.NoError(t, err)
+                require.True(t, exists)
+                require.Equal(t, []byte(fmt.Sprintf("%d", x * 2)), val)
+            }
+            // The loaded shards take writes between and around their keys.
+            for x := 0; x <= num * 2; x += 2 {
+                _, err = m.Insert(Key(x + 1), []byte("odd"))
+                require.NoError(t, err)
+            }
+            _, err = m.Insert(Key(0), []byte("zero"))
+            require.NoError(t, err)
+            return m.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            it, err := m.Iterator()
+            require.NoError(t, err)
+            keys := Collect(it, -1)
+            require.Equal(t, num * 2 + 2, len(keys))
+            for ii, key := range keys {
+                require.Equal(t, Key(ii), key)
+            }
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestBulkLoaderSet(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        loader := NewSetBulkLoader(db, []byte("test"), Key(1), BulkLoaderOptions{FillFactor: 0.5})
+        for x := 0; x < MAX_SHARD_SET_SIZE * 10; x++ {
+            require.NoError(t, loader.Add(Key(x)))
+        }
+        require.NoError(t, loader.Commit())
+
+        aborted := NewSetBulkLoader(db, []byte("test"), Key(2), BulkLoaderOptions{ShardsPerTxn: 1})
+        for x := 0; x < MAX_SHARD_SET_SIZE * 10; x++ {
+            require.NoError(t, aborted.Add(Key(x)))
+        }
+        require.NoError(t, aborted.Abort())
+
+        err := db.View([]byte("test"), func(txn *store.Txn) error {
+            s, err := GetRootSet(Key(1), txn)
+            require.NoError(t, err)
+            defer s.Close()
+            exists, err := s.Contains(Key(42))
+            require.NoError(t, err)
+            require.True(t, exists)
+            key, _, err := s.Max()
+            require.NoError(t, err)
+            require.Equal(t, Key(MAX_SHARD_SET_SIZE * 10 - 1), key)
+
+            // Only the committed loader's shards are left.
+            it := txn.NewIterator(&store.IteratorOptions{Prefix: []byte{tableSet}, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), RangeType: store.RangeClose, Count: -1})
+            defer it.Close()
+            rows := 0
+            for it.Start(); it.Valid(); it.Next() {
+                rows++
+            }
+            require.Equal(t, 20, rows)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func tableRows(t *testing.T, db *store.DB, table byte) int {
+    rows := 0
+    err := db.View([]byte("test"), func(txn *store.Txn) error {
+        it := txn.NewIterator(&store.IteratorOptions{Prefix: []byte{table}, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), RangeType: store.RangeClose, Count: -1})
+        defer it.Close()
+        for it.Start(); it.Valid(); it.Next() {
+            rows++
+        }
+        return nil
+    })
+    require.NoError(t, err)
+    return rows
+}
+
+func TestBulkLoaderReplace(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+            s, err := root.FindSet(Key(1))
+            require.NoError(t, err)
+            for x := 0; x < MAX_SHARD_SET_SIZE * 3; x++ {
+                s.Add(Key(x))
+            }
+            return root.Commit()
+        })
+        require.NoError(t, err)
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            _, err = m.InsertBlob(Key(2), bytes.NewReader(make([]byte, BLOB_CHUNK_BYTES * 2)))
+            require.NoError(t, err)
+            _, err = m.InsertWithTTL(Key(3), []byte("ttl"), time.Hour)
+            require.NoError(t, err)
+            return m.Commit()
+        })
+        require.NoError(t, err)
+        require.NotEqual(t, 0, tableRows(t, db, tableSet))
+        require.NotEqual(t, 0, tableRows(t, db, tableBlob))
+        require.NotEqual(t, 0, tableRows(t, db, tableExpire))
+
+        loader := NewMapBulkLoader(db, []byte("test"), Key(0), BulkLoaderOptions{})
+        for x := 0; x < MAX_SHARD_MAP_SIZE * 2; x++ {
+            require.NoError(t, loader.Insert(Key(x), []byte("new")))
+        }
+        require.NoError(t, loader.Commit())
+        // Everything the old Map stored outside of its root row is released.
+        require.Equal(t, 0, tableRows(t, db, tableSet))
+        require.Equal(t, 0, tableRows(t, db, tableBlob))
+        require.Equal(t, 0, tableRows(t, db, tableExpire))
+
+        // Loading over a different type of collection fails, and the loader can still be aborted.
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            l, err := GetRootList(Key(5), txn)
+            require.NoError(t, err)
+            defer l.Close()
+            l.RPush([]byte("item"))
+            return l.Commit()
+        })
+        require.NoError(t, err)
+        loader = NewMapBulkLoader(db, []byte("test"), Key(5), BulkLoaderOptions{ShardsPerTxn: 1})
+        for x := 0; x < MAX_SHARD_MAP_SIZE * 3; x++ {
+            require.NoError(t, loader.Insert(Key(x), []byte("new")))
+        }
+        mapShards := tableRows(t, db, tableMap)
+        err = loader.Commit()
+        mismatch, ok := err.(*ErrTypeMismatch)
+        require.True(t, ok)
+        require.Equal(t, TypeList, mismatch.Found)
+        require.NoError(t, loader.Abort())
+        require.True(t, tableRows(t, db, tableMap) < mapShards)
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            l, err := GetRootList(Key(5), txn)
+            require.NoError(t, err)
+            defer l.Close()
+            val, exists, err := l.LPeek(Key(0))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, []byte("item"), val)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+var errDeleteFailed = errors.New("delete failed")
+
+// Fails deleting any Map shard while `fail` is set.
+type failingDeleteDB struct {
+    store.IDB
+    fail *bool
+}
+func (db failingDeleteDB) Update(f func(store.ITxn) error) error {
+    return db.IDB.Update(func(txn store.ITxn) error { return f(failingDeleteTxn{txn, db.fail}) })
+}
+
+type failingDeleteTxn struct {
+    store.ITxn
+    fail *bool
+}
+func (txn failingDeleteTxn) Delete(key []byte) error {
+    if *txn.fail && bytes.HasPrefix(key, append([]byte("test"), tableMap)) {
+        return errDeleteFailed
+    }
+    return txn.ITxn.Delete(key)
+}
+
+func TestBulkLoaderReleaseFails(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        fail := false
+        db := store.NewDB(failingDeleteDB{idb, &fail})
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            for x := 0; x < MAX_SHARD_MAP_SIZE * 3; x++ {
+                m.Insert(Key(x), []byte("old"))
+            }
+            return m.Commit()
+        })
+        require.NoError(t, err)
+        before, err := readRootBytes(db, Key(0))
+        require.NoError(t, err)
+
+        loader := NewMapBulkLoader(db, []byte("test"), Key(0), BulkLoaderOptions{})
+        for x := 0; x < 10; x++ {
+            require.NoError(t, loader.Insert(Key(x), []byte("new")))
+        }
+        fail = true
+        require.Equal(t, errDeleteFailed, loader.Commit())
+        // The old Map is still in place and the load can be retried.
+        after, err := readRootBytes(db, Key(0))
+        require.NoError(t, err)
+        require.Equal(t, before, after)
+        fail = false
+        require.NoError(t, loader.Commit())
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            val, _, err := m.Lookup(Key(1))
+            require.NoError(t, err)
+            require.Equal(t, []byte("new"), val)
+            _, exists, err := m.Lookup(Key(10))
+            require.NoError(t, err)
+            require.False(t, exists)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func readRootBytes(db *store.DB, root Key) ([]byte, error) {
+    var state []byte
+    err := db.View([]byte("test"), func(txn *store.Txn) error {
+        b, err := readRootState(root, txn)
+        state = append([]byte{}, b...)
+        return err
+    })
+    return state, err
+}
+
+func TestBulkLoaderSetBloom(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            s, err := GetRootSet(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+            s.Add(Key(1))
+            _, err = s.EnableBloom(DefaultBloomOptions)
+            require.NoError(t, err)
+            return s.Commit()
+        })
+        require.NoError(t, err)
+
+        loader := NewSetBulkLoader(db, []byte("test"), Key(0), BulkLoaderOptions{})
+        for x := 10; x < MAX_SHARD_SET_SIZE * 3; x++ {
+            require.NoError(t, loader.Add(Key(x)))
+        }
+        require.NoError(t, loader.Commit())
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            s, err := GetRootSet(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+            f, exists, err := s.Bloom()
+            require.NoError(t, err)
+            require.True(t, exists)
+            for x := 10; x < MAX_SHARD_SET_SIZE * 3; x++ {
+                maybe, _ := f.MayContain(Key(x))
+                require.True(t, maybe)
+                exists, _ = s.Contains(Key(x))
+                require.True(t, exists)
+            }
+            exists, _ = s.Contains(Key(1))
+            require.False(t, exists)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
@@ -15,10 +15,16 @@ var (
     // all intermediate nodes are strictly maps.
     MapPaths = []Decoder{DecodeMap}
     DecodeSet = setType{}
-    DecodeTuple = tupleType{}
-    DecodeMap = mapType{}
+    DecodeTuple = tupleType{headerTuple, TypeTuple}
+    DecodeSortedSet = tupleType{headerSortedSet, TypeSortedSet}
+    DecodeMultiMap = multiMapType{tupleType{headerMultiMap, TypeMultiMap}}
+    DecodeMap = mapType{mapHeadersMap, TypeMap}
+    DecodeBitmap = mapType{mapHeaders{headerBitmapPrim, headerBitmapPointer, headerBitmapDense}, TypeBitmap}
+    DecodeStream = mapType{mapHeaders{headerStreamPrim, headerStreamPointer, headerStreamDense}, TypeStream}
     DecodeList = listType{}
     DecodeTimeline = timelineType{}
+    DecodeHyperLogLog = hllType{}
+    DecodeBloom = bloomType{DefaultBloomOptions}
 )
 
 
@@ -28,14 +34,26 @@ var (
 // or it can be sharded in which case it will go to the database to fetch the key (if the shard isn't in cache already)
 type Bundle struct {
     iBundle
+    primType Decoder
     cache map[Key]*Bundle
     rootPath []Key
     txn *store.Txn
+    // The Bloom filter of a Set, once loaded.
+    bloom *Bundle
+    // Called before the bundle and its children are committed, like the retention of a Timeline.
+    beforeCommit func() error
 }
 
 func newBundle(txn *store.Txn, rootPath []Key, primType Decoder, primBytes []byte) (*Bundle, error) {
     var v iBundle
     var err error
+    if len(primBytes) == 0 {
+        primBytes = nil
+    }
+    // The header is checked first, since IsPrimitive and IsPointer can accept the bytes of another collection.
+    if found := storedType(primBytes); found != TypeUnknown && found != primType.Type() {
+        return nil, &ErrTypeMismatch{Path: rootPath, Expected: primType.Type(), Found: found}
+    }
     switch  {
     case primType.IsPrimitive(primBytes):
         v, err = newPrimitiveBundle(primType, primBytes, txn.CanWrite())
@@ -47,7 +65,15 @@ func newBundle(txn *store.Txn, rootPath []Key, primType Decoder, primBytes []byt
         fmt.Println("err", rootPath, len(primBytes))
         return nil, InvalidHeader
     }
-    return &Bundle{v, make(map[Key]*Bundle), rootPath, txn}, err
+    if err != nil {
+        return nil, err
+    }
+    return &Bundle{v, primType, make(map[Key]*Bundle), rootPath, txn, nil, nil}, nil
+}
+
+// The type of collection this bundle holds.
+func (bndl *Bundle) Type() CollectionType {
+    return bndl.primType.Type()
 }
 
 // Retrieve the Primitive for `key`, fetching the shard in the DB if necassary.
@@ -77,7 +103,59 @@ func (bndl *Bundle) Write(key Key, value Value) (bool, error) {
         return false, err
     }
     exists := prim.Write(key, value)
-    return exists, err
+    return exists, bndl.wrote(prim)
+}
+
+// Split `prim` after a write once it's twice the size of a shard, popping an embedded bundle out into shards first.
+// This keeps writes cheap no matter how many keys a transaction adds, while leaving Commit to pack shards full.
+func (bndl *Bundle) wrote(prim Primitive) error {
+    if !splitEarly(prim) || !bndl.txn.CanWrite() {
+        return nil
+    }
+    if _, ok := bndl.iBundle.(*primBundle); ok {
+        shardId := bndl.txn.NextShardSeq()[:8]
+        sb, err := newShardBundle(bndl.txn, bndl.primType, prim.MakePointer(shardId))
+        if err != nil {
+            return err
+        }
+        sb.cacheShard(MaxKey, prim)
+        sb.prim = prim
+        sb.primKey = MaxKey
+        sb.popped = true
+        bndl.iBundle = sb
+    }
+    if sb, ok := bndl.iBundle.(*shardBundle); ok {
+        sb.splitFull(prim)
+    }
+    return nil
+}
+
+// The largest key at or before `key`. Keys in earlier shards are found without walking the whole bundle.
+func (bndl *Bundle) Floor(key Key) (Key, bool, error) {
+    prim, err := bndl.Primitive(key)
+    if err != nil {
+        return 0, false, err
+    }
+    if found, ok := floorKey(prim.Keys(), key); ok {
+        return found, true, nil
+    }
+    if sb, ok := bndl.iBundle.(*shardBundle); ok {
+        return sb.floorBefore(key)
+    }
+    return 0, false, nil
+}
+
+// The smallest key at or after `key`.
+func (bndl *Bundle) Ceiling(key Key) (Key, bool, error) {
+    it, err := bndl.Iterator()
+    if err != nil {
+        return 0, false, err
+    }
+    it.Seek(key)
+    if !it.IsValid() {
+        return 0, false, nil
+    }
+    return it.Key(), true, nil
 }
 
 // Delete the value for `key`.
@@ -90,7 +168,32 @@ func (bndl *Bundle) Delete(key Key) (bool, error) {
     return exists, err
 }
 
+// Delete every key between `start` and `end` inclusive. Shards entirely inside the range are deleted without
+// being read, so only the shards at either end are rewritten.
+func (bndl *Bundle) DeleteRange(start, end Key) error {
+    if sb, ok := bndl.iBundle.(*shardBundle); ok {
+        if err := sb.dropShardsIn(start, end); err != nil {
+            return err
+        }
+    }
+    it, err := bndl.Iterator()
+    if err != nil {
+        return err
+    }
+    keys := []Key{}
+    for it.Seek(start); it.IsValid() && it.Key() <= end; it.Next() {
+        keys = append(keys, it.Key())
+    }
+    for _, key := range keys {
+        if _, err := bndl.Delete(key); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
 // Traverse the keys and assume all intermediate nodes are maps. The last key will populate a bundle with the type of `final` and return.
+// If a node on the path holds a different type of collection, an *ErrTypeMismatch is returned.
 func (bndl *Bundle) FindBundle(final Decoder, keys ...Key) (*Bundle, error) {
     return bndl.FindBundleWithCycle(final, MapPaths, keys...)
 }
@@ -131,6 +234,60 @@ func (bndl *Bundle) FindSet(keys ...Key) (*Set, error) {
     return setFromBundle(dbund)
 }
 
+// Shortcut to find a SortedSet collection
+func (bndl *Bundle) FindSortedSet(keys ...Key) (*SortedSet, error) {
+    dbund, err := bndl.FindBundle(DecodeSortedSet, keys...)
+    if err != nil {
+        return nil, err
+    }
+    return sortedSetFromBundle(dbund)
+}
+
+// Shortcut to find a Bitmap collection
+func (bndl *Bundle) FindBitmap(keys ...Key) (*Bitmap, error) {
+    dbund, err := bndl.FindBundle(DecodeBitmap, keys...)
+    if err != nil {
+        return nil, err
+    }
+    return bitmapFromBundle(dbund)
+}
+
+// Shortcut to find a HyperLogLog collection
+func (bndl *Bundle) FindHyperLogLog(keys ...Key) (*HyperLogLog, error) {
+    dbund, err := bndl.FindBundle(DecodeHyperLogLog, keys...)
+    if err != nil {
+        return nil, err
+    }
+    return hyperLogLogFromBundle(dbund)
+}
+
+// Shortcut to find a BloomFilter. `opts` are only used if the filter doesn't exist yet.
+func (bndl *Bundle) FindBloomFilter(opts BloomOptions, keys ...Key) (*BloomFilter, error) {
+    dbund, err := bndl.FindBundle(NewBloomDecoder(opts), keys...)
+    if err != nil {
+        return nil, err
+    }
+    return bloomFilterFromBundle(dbund)
+}
+
+// Shortcut to find a MultiMap collection
+func (bndl *Bundle) FindMultiMap(opts MultiMapOptions, keys ...Key) (*MultiMap, error) {
+    dbund, err := bndl.FindBundle(DecodeMultiMap, keys...)
+    if err != nil {
+        return nil, err
+    }
+    return multiMapFromBundle(dbund, opts)
+}
+
+// Shortcut to find a Stream collection
+func (bndl *Bundle) FindStream(keys ...Key) (*Stream, error) {
+    dbund, err := bndl.FindBundle(DecodeStream, keys...)
+    if err != nil {
+        return nil, err
+    }
+    return streamFromBundle(dbund)
+}
+
 // Traverse the keys and will cycling through Decoders in cycle for the intermediate nodes, repeating the cycle in a loop until all keys are exhausted.
 func (bndl *Bundle) FindBundleWithCycle(final Decoder, cycle []Decoder, keys ...Key) (*Bundle, error) {
     if len(keys) == 0 {
@@ -157,29 +314,98 @@ func (bndl *Bundle) FindBundleWithCycle(final Decoder, cycle []Decoder, keys ...
     return curBundle, nil
 }
 
+// Delete the bundle nested under `key` along with every shard it owns and the blobs stored in it or in anything nested
+// inside it. The shards of bundles nested inside of the child are not visited.
+func (bndl *Bundle) DeleteChild(key Key) (bool, error) {
+    prim, err := bndl.Primitive(key)
+    if err != nil {
+        return false, err
+    }
+    if child, ok := bndl.cache[key]; ok {
+        child.close()
+        delete(bndl.cache, key)
+    }
+    state, exists := prim.Read(key)
+    if !exists {
+        return false, nil
+    }
+    if state != nil {
+        b := state.Bytes()
+        if reg := registrationFor(b); reg != nil && reg.Decoder != nil && reg.Decoder.IsPointer(b) {
+            err = dropShards(bndl.txn, append([]byte{reg.Decoder.Table()}, b[1:9]...))
+            if err != nil {
+                return false, err
+            }
+        }
+        if setBytesHaveBloom(b) {
+            if err := dropSetBloom(bndl.txn, append(append([]Key{}, bndl.rootPath...), key)); err != nil {
+                return false, err
+            }
+        }
+    }
+    // The blobs of the child and of everything nested in it are all in the blob index under its key.
+    if err := dropIndexedBlobs(bndl.txn, bndl.rootPath, key, key); err != nil {
+        return false, err
+    }
+    return prim.Delete(key), nil
+}
+
+// Remove `member` from the Set nested under `key`, deleting the Set once it is empty.
+func (bndl *Bundle) removeFromChildSet(key Key, member Key) (bool, error) {
+    s, err := bndl.FindSet(key)
+    if err != nil {
+        return false, err
+    }
+    exists, err := s.Remove(member)
+    if err != nil || !exists {
+        return exists, err
+    }
+    it, err := s.Iterator()
+    if err != nil {
+        return false, err
+    }
+    if it.Seek(MinKey); !it.IsValid() {
+        _, err = bndl.DeleteChild(key)
+    }
+    return true, err
+}
+
 func (bndl *Bundle) child(key Key, primType Decoder, state Value) (*Bundle, error) {
-    var err error
-    ret, ok := bndl.cache[key]
-    if !ok {
-        path := append(append([]Key{}, bndl.rootPath...), key)
-        var b []byte
-        if state != nil {
-            b = state.Bytes()
+    path := append(append([]Key{}, bndl.rootPath...), key)
+    if ret, ok := bndl.cache[key]; ok {
+        if ret.Type() != primType.Type() {
+            return nil, &ErrTypeMismatch{Path: path, Expected: primType.Type(), Found: ret.Type()}
         }
-        ret, err = newBundle(bndl.txn, path, primType, b)
-        bndl.cache[key] = ret
+        return ret, nil
+    }
+    var b []byte
+    if state != nil {
+        b = state.Bytes()
+    }
+    ret, err := newBundle(bndl.txn, path, primType, b)
+    if err != nil {
+        return nil, err
     }
-    return ret, err
+    bndl.cache[key] = ret
+    return ret, nil
 }
 
 func (bndl *Bundle) close() {
     for _, subbundle := range bndl.cache {
         subbundle.Close()
     }
+    if bndl.bloom != nil {
+        bndl.bloom.close()
+    }
     bndl.iBundle.Close()
 }
 
 func (bndl *Bundle) commit(txn *store.Txn) (Value, error) {
+    if bndl.beforeCommit != nil {
+        if err := bndl.beforeCommit(); err != nil {
+            return nil, err
+        }
+    }
     for key, subbundle := range bndl.cache {
         subret, err := subbundle.commit(txn)
         if err != nil {
@@ -194,6 +420,19 @@ func (bndl *Bundle) commit(txn *store.Txn) (Value, error) {
         }
 
     }
+    if bndl.bloom != nil {
+        state, err := bndl.bloom.commit(txn)
+        if err != nil {
+            return nil, err
+        }
+        if state != nil {
+            var b bytes.Buffer
+            state.Serialize(&b)
+            if err := txn.Set(setBloomKey(bndl.rootPath), b.Bytes()); err != nil {
+                return nil, err
+            }
+        }
+    }
     return bndl.iBundle.Commit(txn)
 }
 
@@ -204,25 +443,30 @@ type Root struct {
 }
 
 // An application will be divided into different Roots. There might be several Root for different indexes and different roots for different collections of data.
+// Returns an *ErrTypeMismatch if the root was written by a different type of collection than `primType`.
 func NewRootWithDecoder(root Key, primType Decoder, txn *store.Txn) (*Root, error) {
-    var bndl *Bundle
-    var err error
+    state, err := readRootState(root, txn)
+    if err != nil {
+        return nil, err
+    }
+    return newRoot(root, primType, state, txn)
+}
 
+func readRootState(root Key, txn *store.Txn) ([]byte, error) {
     rootBytes := append([]byte{tableTopLevel}, root.Bytes()...)
 
-    var state []byte
     switch item, err := txn.Get(rootBytes); {
     case err == nil:
-        state, err = item.Value()
-        if err != nil {
-            panic(err)
-        }
+        return item.Value()
     case err == store.ErrKeyNotFound:
-        state = nil
+        return nil, nil
     default:
         return nil, err
     }
-    bndl, err = newBundle(txn, []Key{root}, primType, state)
+}
+
+func newRoot(root Key, primType Decoder, state []byte, txn *store.Txn) (*Root, error) {
+    bndl, err := newBundle(txn, []Key{root}, primType, state)
     if err != nil {
         return nil, err
     }
@@ -262,6 +506,48 @@ func GetRootTimeline(root Key, txn *store.Txn) (*RootTimeline, error) {
     return timelineFromRoot(r)
 }
 
+func GetRootSortedSet(root Key, txn *store.Txn) (*RootSortedSet, error) {
+    r, err := NewRootWithDecoder(root, DecodeSortedSet, txn)
+    if err != nil {
+        return nil, err
+    }
+    return sortedSetFromRoot(r)
+}
+func GetRootBitmap(root Key, txn *store.Txn) (*RootBitmap, error) {
+    r, err := NewRootWithDecoder(root, DecodeBitmap, txn)
+    if err != nil {
+        return nil, err
+    }
+    return bitmapFromRoot(r)
+}
+func GetRootHyperLogLog(root Key, txn *store.Txn) (*RootHyperLogLog, error) {
+    r, err := NewRootWithDecoder(root, DecodeHyperLogLog, txn)
+    if err != nil {
+        return nil, err
+    }
+    return hyperLogLogFromRoot(r)
+}
+func GetRootBloomFilter(root Key, opts BloomOptions, txn *store.Txn) (*RootBloomFilter, error) {
+    r, err := NewRootWithDecoder(root, NewBloomDecoder(opts), txn)
+    if err != nil {
+        return nil, err
+    }
+    return bloomFilterFromRoot(r)
+}
+func GetRootMultiMap(root Key, opts MultiMapOptions, txn *store.Txn) (*RootMultiMap, error) {
+    r, err := NewRootWithDecoder(root, DecodeMultiMap, txn)
+    if err != nil {
+        return nil, err
+    }
+    return multiMapFromRoot(r, opts)
+}
+func GetRootStream(root Key, txn *store.Txn) (*RootStream, error) {
+    r, err := NewRootWithDecoder(root, DecodeStream, txn)
+    if err != nil {
+        return nil, err
+    }
+    return streamFromRoot(r)
+}
 
 
 // Cleans up any resources that may have been opened by the Bundle or the Bundle's children.
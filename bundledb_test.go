@@ -0,0 +1,304 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func requireTypeMismatch(t *testing.T, err error, expected, found CollectionType) {
+    mismatch, ok := err.(*ErrTypeMismatch)
+    require.True(t, ok, "expected *ErrTypeMismatch, got %v", err)
+    require.Equal(t, expected, mismatch.Expected)
+    require.Equal(t, found, mismatch.Found)
+}
+
+func TestRootTypeMismatch(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, _ := GetRootMap(Key(0), txn)
+            defer mm.Close()
+            mm.Insert(Key(1), []byte("cool"))
+
+            l, _ := GetRootList(Key(1), txn)
+            defer l.Close()
+            l.RPush([]byte("cool"))
+
+            err := mm.Commit()
+            if err != nil {
+                return err
+            }
+            return l.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            _, err := GetRootSet(Key(0), txn)
+            requireTypeMismatch(t, err, TypeSet, TypeMap)
+
+            _, err = GetRootMap(Key(1), txn)
+            requireTypeMismatch(t, err, TypeMap, TypeList)
+
+            mm, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            mm.Close()
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestNestedTypeMismatch(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            nm, err := root.FindMap(Key(1), Key(2))
+            require.NoError(t, err)
+            nm.Insert(Key(3), []byte("cool"))
+
+            // Same transaction, the cached bundle is a Map.
+            _, err = root.FindList(Key(1), Key(2))
+            requireTypeMismatch(t, err, TypeList, TypeMap)
+
+            // A user value is not a collection.
+            _, err = root.FindSet(Key(1), Key(2), Key(3))
+            requireTypeMismatch(t, err, TypeSet, TypeValue)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            _, err := root.FindSet(Key(1), Key(2))
+            requireTypeMismatch(t, err, TypeSet, TypeMap)
+
+            _, err = root.FindTimeline(Key(1))
+            requireTypeMismatch(t, err, TypeTimeline, TypeMap)
+
+            nm, err := root.FindMap(Key(1), Key(2))
+            require.NoError(t, err)
+            val, _, err := nm.Lookup(Key(3))
+            require.NoError(t, err)
+            require.Equal(t, []byte("cool"), val)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestDeleteChild(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            small, _ := root.FindSet(Key(1))
+            small.Add(Key(1))
+            big, _ := root.FindSet(Key(2))
+            for x := 0; x < MAX_SHARD_SET_SIZE * 4; x++ {
+                big.Add(Key(x))
+            }
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            require.True(t, countKeys(txn) > 2)
+
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            // Opened children are dropped from the cache as well.
+            big, _ := root.FindSet(Key(2))
+            big.Add(Key(10000))
+
+            for _, k := range []Key{Key(1), Key(2)} {
+                exists, err := root.DeleteChild(k)
+                require.NoError(t, err)
+                require.True(t, exists)
+            }
+            exists, err := root.DeleteChild(Key(3))
+            require.NoError(t, err)
+            require.False(t, exists)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            require.Equal(t, 1, countKeys(txn))
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestBitmapType(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+            bm, err := root.FindBitmap(Key(1))
+            require.NoError(t, err)
+            bm.SetBit(Key(3), true)
+            m, err := root.FindMap(Key(2))
+            require.NoError(t, err)
+            m.Insert(Key(1), []byte("cool"))
+
+            rbm, _ := GetRootBitmap(Key(1), txn)
+            defer rbm.Close()
+            rbm.SetBit(Key(3), true)
+            for _, err := range []error{root.Commit(), rbm.Commit()} {
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            _, err := root.FindMap(Key(1))
+            requireTypeMismatch(t, err, TypeMap, TypeBitmap)
+            _, err = root.FindBitmap(Key(2))
+            requireTypeMismatch(t, err, TypeBitmap, TypeMap)
+            _, err = GetRootMap(Key(1), txn)
+            requireTypeMismatch(t, err, TypeMap, TypeBitmap)
+
+            child, err := root.ChildAny(Key(1))
+            require.NoError(t, err)
+            bm, ok := child.(*Bitmap)
+            require.True(t, ok)
+            v, _ := bm.GetBit(Key(3))
+            require.True(t, v)
+
+            broot, coll, err := OpenAny(Key(1), txn)
+            require.NoError(t, err)
+            defer broot.Close()
+            _, ok = coll.(*Bitmap)
+            require.True(t, ok)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestStreamType(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+            s, err := root.FindStream(Key(1))
+            require.NoError(t, err)
+            s.XAdd([]byte("cool"))
+            bm, err := root.FindBitmap(Key(2))
+            require.NoError(t, err)
+            bm.SetBit(Key(3), true)
+
+            rs, _ := GetRootStream(Key(1), txn)
+            defer rs.Close()
+            rs.XAdd([]byte("cool"))
+            for _, err := range []error{root.Commit(), rs.Commit()} {
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            _, err := root.FindMap(Key(1))
+            requireTypeMismatch(t, err, TypeMap, TypeStream)
+            _, err = root.FindStream(Key(2))
+            requireTypeMismatch(t, err, TypeStream, TypeBitmap)
+            _, err = GetRootMap(Key(1), txn)
+            requireTypeMismatch(t, err, TypeMap, TypeStream)
+
+            child, err := root.ChildAny(Key(1))
+            require.NoError(t, err)
+            _, ok := child.(*Stream)
+            require.True(t, ok)
+
+            sroot, coll, err := OpenAny(Key(1), txn)
+            require.NoError(t, err)
+            defer sroot.Close()
+            _, ok = coll.(*Stream)
+            require.True(t, ok)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+// A Set decoder that claims every value, like a careless custom Decoder.
+type acceptAllType struct{ setType }
+func (x acceptAllType) IsPrimitive(b []byte) bool { return true }
+
+func TestEmptyTypeMismatch(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            s, _ := GetRootSet(Key(0), txn)
+            defer s.Close()
+            tl, _ := GetRootTimeline(Key(1), txn)
+            defer tl.Close()
+
+            root, _ := GetRootBundle(Key(2), txn)
+            defer root.Close()
+            _, err := root.FindList(Key(1))
+            require.NoError(t, err)
+            _, err = root.FindMap(Key(2), Key(3))
+            require.NoError(t, err)
+            for _, err := range []error{s.Commit(), tl.Commit(), root.Commit()} {
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            // Collections that were opened and committed without any writes still record their type.
+            _, err := GetRootMap(Key(0), txn)
+            requireTypeMismatch(t, err, TypeMap, TypeSet)
+            _, err = GetRootList(Key(1), txn)
+            requireTypeMismatch(t, err, TypeList, TypeTimeline)
+
+            tl, err := GetRootTimeline(Key(1), txn)
+            require.NoError(t, err)
+            defer tl.Close()
+            _, key, _ := tl.Current()
+            require.Equal(t, Key(0), key)
+
+            root, _ := GetRootBundle(Key(2), txn)
+            defer root.Close()
+            _, err = root.FindSet(Key(1))
+            requireTypeMismatch(t, err, TypeSet, TypeList)
+            _, err = root.FindList(Key(2), Key(3))
+            requireTypeMismatch(t, err, TypeList, TypeMap)
+
+            // The stored type is checked before the Decoder gets to accept the bytes.
+            _, err = root.FindBundle(acceptAllType{}, Key(2))
+            requireTypeMismatch(t, err, TypeSet, TypeMap)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
@@ -0,0 +1,230 @@
+package bundledb
+
+// Like a shardIterator, each combinator starts at the first key when it is used before any Seek.
+type filterIterator struct {
+    it BundleIterator
+    keep func(Key) bool
+    started bool
+}
+// Only the keys of `it` for which `keep` returns true
+func Filter(it BundleIterator, keep func(Key) bool) BundleIterator {
+    return &filterIterator{it: it, keep: keep}
+}
+func (f *filterIterator) start() {
+    if !f.started {
+        f.Seek(MinKey)
+    }
+}
+func (f *filterIterator) IsValid() bool {
+    f.start()
+    return f.it.IsValid()
+}
+func (f *filterIterator) Key() Key {
+    f.start()
+    return f.it.Key()
+}
+func (f *filterIterator) Err() error { return IterErr(f.it) }
+func (f *filterIterator) EstimatedSize() int { return estimatedSize(f.it) }
+func (f *filterIterator) Next() {
+    if !f.started {
+        f.Seek(MinKey)
+        return
+    }
+    f.it.Next()
+    f.skip()
+}
+func (f *filterIterator) Seek(key Key) {
+    f.started = true
+    f.it.Seek(key)
+    f.skip()
+}
+func (f *filterIterator) skip() {
+    for f.it.IsValid() && !f.keep(f.it.Key()) {
+        f.it.Next()
+    }
+}
+
+type rangeIterator struct {
+    it BundleIterator
+    start Key
+    end Key
+    started bool
+}
+// The keys of `it` between `start` and `end` inclusive
+func KeyRange(it BundleIterator, start, end Key) BundleIterator {
+    return &rangeIterator{it: it, start: start, end: end}
+}
+func (r *rangeIterator) IsValid() bool {
+    if !r.started {
+        r.Seek(MinKey)
+    }
+    return r.start <= r.end && r.it.IsValid() && r.it.Key() <= r.end
+}
+func (r *rangeIterator) Key() Key {
+    if !r.started {
+        r.Seek(MinKey)
+    }
+    return r.it.Key()
+}
+func (r *rangeIterator) Err() error { return IterErr(r.it) }
+func (r *rangeIterator) EstimatedSize() int { return estimatedSize(r.it) }
+func (r *rangeIterator) Next() {
+    if !r.started {
+        r.Seek(MinKey)
+        return
+    }
+    r.it.Next()
+}
+func (r *rangeIterator) Seek(key Key) {
+    r.started = true
+    if key < r.start {
+        key = r.start
+    }
+    r.it.Seek(key)
+}
+
+// Limit and Skip find the key at position `n` the first time they are used and then act as a KeyRange, so
+// seeking into the middle of them still only sees the keys at the right positions of `it`.
+type positionIterator struct {
+    it BundleIterator
+    n int
+    skip bool
+    bounded BundleIterator
+    started bool
+}
+// The first `n` keys of `it`
+func Limit(it BundleIterator, n int) BundleIterator {
+    return &positionIterator{it: it, n: n}
+}
+// Every key of `it` after the first `n`
+func Skip(it BundleIterator, n int) BundleIterator {
+    return &positionIterator{it: it, n: n, skip: true}
+}
+func (p *positionIterator) resolve() BundleIterator {
+    if p.bounded != nil {
+        return p.bounded
+    }
+    ii := 0
+    p.it.Seek(MinKey)
+    for ; p.it.IsValid() && ii < p.n; p.it.Next() {
+        ii++
+    }
+    switch {
+    case p.skip && p.it.IsValid():
+        p.bounded = KeyRange(p.it, p.it.Key(), MaxKey)
+    case p.skip || p.n <= 0:
+        p.bounded = NilIterator()
+    case p.it.IsValid():
+        // The source is on the first key we drop.
+        p.bounded = &beforeIterator{p.it, p.it.Key()}
+    default:
+        p.bounded = p.it
+    }
+    return p.bounded
+}
+func (p *positionIterator) start() BundleIterator {
+    if !p.started {
+        p.Seek(MinKey)
+    }
+    return p.bounded
+}
+func (p *positionIterator) IsValid() bool { return p.start().IsValid() }
+func (p *positionIterator) Key() Key { return p.start().Key() }
+func (p *positionIterator) Err() error { return IterErr(p.it) }
+func (p *positionIterator) EstimatedSize() int {
+    if !p.skip && p.n < estimatedSize(p.it) {
+        return p.n
+    }
+    return estimatedSize(p.it)
+}
+func (p *positionIterator) Next() {
+    if !p.started {
+        p.Seek(MinKey)
+        return
+    }
+    p.bounded.Next()
+}
+func (p *positionIterator) Seek(key Key) {
+    p.started = true
+    p.resolve().Seek(key)
+}
+
+// The keys of `it` strictly less than `end`
+type beforeIterator struct {
+    it BundleIterator
+    end Key
+}
+func (b *beforeIterator) IsValid() bool { return b.it.IsValid() && b.it.Key() < b.end }
+func (b *beforeIterator) Key() Key { return b.it.Key() }
+func (b *beforeIterator) Err() error { return IterErr(b.it) }
+func (b *beforeIterator) Next() { b.it.Next() }
+func (b *beforeIterator) Seek(key Key) { b.it.Seek(key) }
+
+type transformIterator struct {
+    it BundleIterator
+    f func(Key) Key
+    done bool
+    started bool
+}
+// Map every key of `it` through `f`. `f` must never decrease, if a < b then f(a) <= f(b), so the result stays
+// in order. Keys that map to the same value are only returned once. Seek binary searches for the source key, calling
+// `f` about 64 times, so `f` must be cheap.
+func Transform(it BundleIterator, f func(Key) Key) BundleIterator {
+    return &transformIterator{it: it, f: f}
+}
+func (t *transformIterator) IsValid() bool {
+    if !t.started {
+        t.Seek(MinKey)
+    }
+    return !t.done && t.it.IsValid()
+}
+func (t *transformIterator) Key() Key {
+    if !t.started {
+        t.Seek(MinKey)
+    }
+    return t.f(t.it.Key())
+}
+func (t *transformIterator) Err() error { return IterErr(t.it) }
+func (t *transformIterator) EstimatedSize() int { return estimatedSize(t.it) }
+// Step the source once. Only if it maps to the same key again does Next seek past the run of duplicates.
+func (t *transformIterator) Next() {
+    if !t.IsValid() {
+        return
+    }
+    current := t.Key()
+    t.it.Next()
+    if t.it.IsValid() && t.f(t.it.Key()) == current {
+        if current == MaxKey {
+            t.done = true
+            return
+        }
+        t.Seek(current + 1)
+    }
+}
+// Binary search for the smallest source key that maps to at least `key`, then seek the source there.
+func (t *transformIterator) Seek(key Key) {
+    t.started = true
+    t.done = t.f(MaxKey) < key
+    if t.done {
+        return
+    }
+    lo, hi := MinKey, MaxKey
+    for lo < hi {
+        mid := lo + (hi - lo) / 2
+        if t.f(mid) >= key {
+            hi = mid
+        } else {
+            lo = mid + 1
+        }
+    }
+    t.it.Seek(lo)
+}
+
+// Read up to `max` keys of `it` from the start, or every key if `max` is negative.
+func Collect(it BundleIterator, max int) []Key {
+    keys := []Key{}
+    for it.Seek(MinKey); it.IsValid() && (max < 0 || len(keys) < max); it.Next() {
+        keys = append(keys, it.Key())
+    }
+    return keys
+}
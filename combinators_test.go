@@ -0,0 +1,88 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestCombinators(t *testing.T) {
+    keys := func() BundleIterator { return ListIterator([]Key{1, 2, 3, 5, 8, 13, 21}) }
+    odd := func(k Key) bool { return k % 2 == 1 }
+
+    require.Equal(t, []Key{1, 3, 5, 13, 21}, Collect(Filter(keys(), odd), -1))
+    require.Equal(t, []Key{1, 3}, Collect(Filter(keys(), odd), 2))
+    require.Equal(t, []Key{3, 5, 8}, Collect(KeyRange(keys(), 3, 12), -1))
+    require.Equal(t, []Key{1, 2, 3}, Collect(Limit(keys(), 3), -1))
+    require.Equal(t, []Key{5, 8, 13, 21}, Collect(Skip(keys(), 3), -1))
+    require.Equal(t, []Key{}, Collect(Skip(keys(), 30), -1))
+    require.Equal(t, []Key{}, Collect(Limit(keys(), 0), -1))
+    require.Equal(t, []Key{0, 1, 2, 4, 6, 10}, Collect(Transform(keys(), func(k Key) Key { return k / 2 }), -1))
+
+    // Seeking into a Limit or Skip keeps positions relative to the whole source.
+    limit := Limit(keys(), 4)
+    limit.Seek(Key(4))
+    require.Equal(t, Key(5), limit.Key())
+    limit.Next()
+    require.False(t, limit.IsValid())
+    skip := Skip(keys(), 2)
+    skip.Seek(Key(1))
+    require.Equal(t, Key(3), skip.Key())
+
+    transform := Transform(keys(), func(k Key) Key { return k * 10 })
+    transform.Seek(Key(31))
+    require.Equal(t, Key(50), transform.Key())
+
+    // Combinators compose with the set algebra.
+    evens := ListIterator([]Key{2, 8, 10})
+    require.Equal(t, []Key{2, 8}, Collect(Intersect(Skip(keys(), 1), evens), -1))
+
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            s, err := GetRootSet(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+            for x := 0; x < MAX_SHARD_SET_SIZE * 3; x++ {
+                s.Add(Key(x))
+            }
+            return s.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            s, err := GetRootSet(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+
+            it, _ := s.Iterator()
+            page := Limit(Skip(Filter(it, odd), 5), 3)
+            require.Equal(t, []Key{11, 13, 15}, Collect(page, -1))
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestCombinatorsWithoutSeek(t *testing.T) {
+    keys := func() BundleIterator { return ListIterator([]Key{1, 2, 3, 5, 8, 13, 21}) }
+    walk := func(it BundleIterator) []Key {
+        found := []Key{}
+        for ; it.IsValid(); it.Next() {
+            found = append(found, it.Key())
+        }
+        return found
+    }
+
+    require.Equal(t, []Key{2, 8}, walk(Filter(keys(), func(k Key) bool { return k % 2 == 0 })))
+    require.Equal(t, []Key{3, 5, 8}, walk(KeyRange(keys(), 3, 12)))
+    require.Equal(t, []Key{1, 2, 3}, walk(Limit(keys(), 3)))
+    require.Equal(t, []Key{5, 8, 13, 21}, walk(Skip(keys(), 3)))
+    require.Equal(t, []Key{0, 1, 2, 4, 6, 10}, walk(Transform(keys(), func(k Key) Key { return k / 2 })))
+
+    // Next before anything else lands on the first key.
+    it := KeyRange(keys(), 3, 12)
+    it.Next()
+    require.Equal(t, Key(3), it.Key())
+}
@@ -6,4 +6,9 @@ var (
     tableSet = byte(1)
     tableMap = byte(2)
     tableTopLevel = byte(0)
+    tableExpire = byte(3)
+    tableBlob = byte(4)
+    tableBloom = byte(5)
+    tableSetBloom = byte(6)
+    tableBlobIndex = byte(7)
 )
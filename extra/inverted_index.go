@@ -0,0 +1,135 @@
+package extra
+
+import (
+    "hash/fnv"
+    "strings"
+    "unicode"
+    bdb "github.com/hansonkd/bundledb"
+    "github.com/hansonkd/bundledb/store"
+)
+
+// An InvertedIndex maps terms to the documents that contain them. It is a MultiMap of term -> Set of document IDs whose
+// reverse index keeps the terms of each document, so documents can be removed or reindexed.
+//
+// Terms are hashed to 8 byte keys with FNV-1a. Two terms that hash to the same key will match the same documents.
+type InvertedIndex struct {
+    postings *bdb.RootMultiMap
+}
+
+func NewInvertedIndex(rootKey bdb.Key, txn *store.Txn) (*InvertedIndex, error) {
+    postings, err := bdb.GetRootMultiMap(rootKey, bdb.MultiMapOptions{Reverse: true}, txn)
+    if err != nil {
+        return nil, err
+    }
+    return &InvertedIndex{postings}, nil
+}
+
+// Split `text` into lowercase terms made of letters and digits. Each term is returned once.
+func Tokenize(text string) []string {
+    seen := map[string]bool{}
+    terms := []string{}
+    for _, term := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    }) {
+        if !seen[term] {
+            seen[term] = true
+            terms = append(terms, term)
+        }
+    }
+    return terms
+}
+
+// The key a term is stored under.
+func TermKey(term string) bdb.Key {
+    h := fnv.New64a()
+    h.Write([]byte(strings.ToLower(term)))
+    return bdb.Key(h.Sum64())
+}
+
+// Index the terms of `text` under `doc`, replacing whatever `doc` was indexed with before.
+func (idx *InvertedIndex) Index(doc bdb.Key, text string) error {
+    if _, err := idx.Remove(doc); err != nil {
+        return err
+    }
+    for _, term := range Tokenize(text) {
+        if _, err := idx.postings.Add(TermKey(term), doc); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Remove `doc` from every term it was indexed under, returning true if it was indexed.
+func (idx *InvertedIndex) Remove(doc bdb.Key) (bool, error) {
+    it, err := idx.postings.GetReverse(doc)
+    if err != nil {
+        return false, err
+    }
+    terms := []bdb.Key{}
+    for ; it.IsValid(); it.Next() {
+        terms = append(terms, it.Key())
+    }
+    for _, term := range terms {
+        if _, err := idx.postings.Remove(term, doc); err != nil {
+            return false, err
+        }
+    }
+    return len(terms) > 0, nil
+}
+
+// Documents containing `term`.
+func (idx *InvertedIndex) Term(term string) (bdb.BundleIterator, error) {
+    return idx.postings.Get(TermKey(term))
+}
+
+func (idx *InvertedIndex) terms(terms []string) ([]bdb.BundleIterator, error) {
+    its := make([]bdb.BundleIterator, len(terms))
+    for ii, term := range terms {
+        it, err := idx.Term(term)
+        if err != nil {
+            return nil, err
+        }
+        its[ii] = it
+    }
+    return its, nil
+}
+
+// Documents containing every one of `terms`. The iterator is positioned at the first document.
+func (idx *InvertedIndex) And(terms ...string) (bdb.BundleIterator, error) {
+    its, err := idx.terms(terms)
+    if err != nil || len(its) == 0 {
+        return bdb.NilIterator(), err
+    }
+    it := bdb.Intersect(its...)
+    it.Seek(bdb.MinKey)
+    return it, nil
+}
+
+// Documents containing any of `terms`. The iterator is positioned at the first document.
+func (idx *InvertedIndex) Or(terms ...string) (bdb.BundleIterator, error) {
+    its, err := idx.terms(terms)
+    if err != nil || len(its) == 0 {
+        return bdb.NilIterator(), err
+    }
+    it := bdb.Union(its...)
+    it.Seek(bdb.MinKey)
+    return it, nil
+}
+
+// Documents from `base` that contain none of `terms`. The iterator is positioned at the first document.
+func (idx *InvertedIndex) Not(base bdb.BundleIterator, terms ...string) (bdb.BundleIterator, error) {
+    its, err := idx.terms(terms)
+    if err != nil {
+        return nil, err
+    }
+    it := bdb.Difference(base, its...)
+    it.Seek(bdb.MinKey)
+    return it, nil
+}
+
+func (idx *InvertedIndex) Commit() error {
+    return idx.postings.Commit()
+}
+func (idx *InvertedIndex) Close() {
+    idx.postings.Close()
+}
@@ -0,0 +1,100 @@
+package extra
+
+import (
+    "fmt"
+    "testing"
+    bdb "github.com/hansonkd/bundledb"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func collectDocs(it bdb.BundleIterator) []bdb.Key {
+    docs := []bdb.Key{}
+    for ; it.IsValid(); it.Next() {
+        docs = append(docs, it.Key())
+    }
+    return docs
+}
+
+func TestInvertedIndex(t *testing.T) {
+    require.Equal(t, []string{"the", "quick", "fox", "2"}, Tokenize("The quick, quick FOX! (2)"))
+
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            idx, err := NewInvertedIndex(bdb.Key(0), txn)
+            require.NoError(t, err)
+            defer idx.Close()
+
+            for x := 0; x < 30; x++ {
+                text := fmt.Sprintf("doc%d all", x)
+                if x % 2 == 0 {
+                    text += " even"
+                }
+                if x % 3 == 0 {
+                    text += " three"
+                }
+                require.NoError(t, idx.Index(bdb.Key(x), text))
+            }
+            m, err := bdb.GetRootMap(bdb.Key(1), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            m.Insert(bdb.Key(0), []byte("not an index"))
+            require.NoError(t, m.Commit())
+            return idx.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            idx, err := NewInvertedIndex(bdb.Key(0), txn)
+            require.NoError(t, err)
+            defer idx.Close()
+
+            it, err := idx.And("even", "three")
+            require.NoError(t, err)
+            require.Equal(t, []bdb.Key{0, 6, 12, 18, 24}, collectDocs(it))
+
+            it, err = idx.Or("doc1", "doc4", "missing")
+            require.NoError(t, err)
+            require.Equal(t, []bdb.Key{1, 4}, collectDocs(it))
+
+            base, err := idx.And("three")
+            require.NoError(t, err)
+            it, err = idx.Not(base, "even")
+            require.NoError(t, err)
+            require.Equal(t, []bdb.Key{3, 9, 15, 21, 27}, collectDocs(it))
+
+            // Reindexing drops the old terms.
+            require.NoError(t, idx.Index(bdb.Key(6), "doc6 all"))
+            removed, err := idx.Remove(bdb.Key(12))
+            require.NoError(t, err)
+            require.True(t, removed)
+            return idx.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            idx, err := NewInvertedIndex(bdb.Key(0), txn)
+            require.NoError(t, err)
+            defer idx.Close()
+
+            it, err := idx.And("even", "three")
+            require.NoError(t, err)
+            require.Equal(t, []bdb.Key{0, 18, 24}, collectDocs(it))
+            it, err = idx.Term("doc12")
+            require.NoError(t, err)
+            require.Equal(t, []bdb.Key{}, collectDocs(it))
+            it, err = idx.Term("all")
+            require.NoError(t, err)
+            require.Equal(t, 29, len(collectDocs(it)))
+
+            // A root holding something else is an error, not a panic.
+            _, err = NewInvertedIndex(bdb.Key(1), txn)
+            _, ok := err.(*bdb.ErrTypeMismatch)
+            require.True(t, ok)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
@@ -0,0 +1,87 @@
+package bundledb
+
+import (
+    "errors"
+    "time"
+)
+
+var (
+    ClockOverflow = errors.New("No clock key is left after the Timeline's current key")
+    ClockKeysOnly = errors.New("Timeline is written by SetNow, which is the only way to add entries to it")
+    NotClockTimeline = errors.New("Timeline was not written by SetNow")
+)
+
+// Hybrid logical clock keys keep the wall clock time in milliseconds in the top 48 bits and a counter in the
+// low 16 bits, so keys written in the same millisecond, or while the clock runs backwards, still increase.
+const hlcLogicalBits = 16
+
+// The key for the wall clock time `t` and logical counter `logical`.
+func HLCKey(t time.Time, logical uint16) Key {
+    return Key(uint64(t.UnixNano() / int64(time.Millisecond)) << hlcLogicalBits | uint64(logical))
+}
+
+// The wall clock time of a HLC key, to the millisecond.
+func HLCTime(key Key) time.Time {
+    ms := int64(key >> hlcLogicalBits)
+    return time.Unix(ms / 1000, (ms % 1000) * int64(time.Millisecond))
+}
+
+// The logical counter of a HLC key.
+func HLCLogical(key Key) uint16 {
+    return uint16(key & (1 << hlcLogicalBits - 1))
+}
+
+// Use `clock` instead of time.Now for SetNow.
+func (d *Timeline) SetClock(clock func() time.Time) {
+    d.clock = clock
+}
+
+// Whether nothing has been written to the Timeline yet.
+func (d *Timeline) empty() bool {
+    return d.currentKey == MinKey && len(d.currentVal) == 0
+}
+
+// Set `val` as the current value under a HLC key for now. The key is always after the current key, so writers
+// sharing a Timeline never collide even if their clocks disagree. The first SetNow marks the Timeline as written by
+// SetNow, after which Set and SetNext can only change existing entries. Returns NotClockTimeline if the Timeline
+// already has entries from Set or SetNext.
+func (d *Timeline) SetNow(val []byte) (Key, error) {
+    if !d.clockKeys {
+        if !d.empty() {
+            return 0, NotClockTimeline
+        }
+        prim, err := d.bund.Primitive(TimelineCurrent)
+        if err != nil {
+            return 0, err
+        }
+        ptline := prim.(*primTimeline)
+        ptline.header = headerTimelineClock
+        ptline.dirty = true
+        d.clockKeys = true
+    }
+    clock := d.clock
+    if clock == nil {
+        clock = time.Now
+    }
+    key := HLCKey(clock(), 0)
+    if key <= d.currentKey {
+        if d.currentKey == MaxKey {
+            return 0, ClockOverflow
+        }
+        key = d.currentKey + 1
+    }
+    _, err := d.set(key, val)
+    return key, err
+}
+
+// The latest entry written at or before `t` by SetNow. Returns NotClockTimeline if the Timeline has entries that
+// weren't written by SetNow.
+func (d *Timeline) AtTime(t time.Time) ([]byte, Key, bool, error) {
+    if !d.clockKeys {
+        if d.empty() {
+            return nil, 0, false, nil
+        }
+        return nil, 0, false, NotClockTimeline
+    }
+    return d.At(HLCKey(t, 1 << hlcLogicalBits - 1))
+}
@@ -0,0 +1,128 @@
+//go:build go1.23
+
+package bundledb
+
+import (
+    "iter"
+)
+
+// Walk `it` from the start as a range-over-func sequence. Useful for the results of Intersect, Union and the other combinators.
+// Check IterErr(it) after the loop.
+func Keys(it BundleIterator) iter.Seq[Key] {
+    return func(yield func(Key) bool) {
+        for it.Seek(MinKey); it.IsValid(); it.Next() {
+            if !yield(it.Key()) {
+                return
+            }
+        }
+    }
+}
+
+// Walk `it` from the start with a nil value for every key, so set algebra results range like a Map. Check
+// IterErr(it) after the loop.
+func All(it BundleIterator) iter.Seq2[Key, []byte] {
+    return seqAll(it, nil, nilLookup)
+}
+
+func nilLookup(Key) ([]byte, bool, error) { return nil, true, nil }
+
+// Walk `it` from the start, reading each value with `lookup`. The error that stops the walk, from opening the
+// iterator, a lookup or a shard read, is stored in `errp`, which is reset when the walk starts.
+func seqAll(it BundleIterator, errp *error, lookup func(Key) ([]byte, bool, error)) iter.Seq2[Key, []byte] {
+    return func(yield func(Key, []byte) bool) {
+        var err error
+        defer func() {
+            if err == nil {
+                err = IterErr(it)
+            }
+            if errp != nil {
+                *errp = err
+            }
+        }()
+        for it.Seek(MinKey); it.IsValid(); it.Next() {
+            key := it.Key()
+            var val []byte
+            var exists bool
+            if val, exists, err = lookup(key); err != nil {
+                return
+            }
+            if exists && !yield(key, val) {
+                return
+            }
+        }
+    }
+}
+
+// Walk an iterator that failed to open, reporting `err` in `errp`.
+func seqFailed(err error, errp *error) iter.Seq2[Key, []byte] {
+    return func(yield func(Key, []byte) bool) { *errp = err }
+}
+
+func seqKeys(all iter.Seq2[Key, []byte]) iter.Seq[Key] {
+    return func(yield func(Key) bool) {
+        for k := range all {
+            if !yield(k) {
+                return
+            }
+        }
+    }
+}
+
+func seqOf(it BundleIterator, err error, errp *error, lookup func(Key) ([]byte, bool, error)) iter.Seq2[Key, []byte] {
+    if err != nil {
+        return seqFailed(err, errp)
+    }
+    return seqAll(it, errp, lookup)
+}
+
+// Every key in the Map. Check Err after the loop.
+func (m *Map) Keys() iter.Seq[Key] {
+    it, err := m.Iterator()
+    return seqKeys(seqOf(it, err, &m.iterErr, nilLookup))
+}
+// Every key and value in the Map. Expired entries are skipped. Check Err after the loop.
+func (m *Map) All() iter.Seq2[Key, []byte] {
+    it, err := m.Iterator()
+    return seqOf(it, err, &m.iterErr, m.Lookup)
+}
+// The error that stopped the last Keys or All loop over the Map, if any. Each loop resets it when it starts.
+func (m *Map) Err() error { return m.iterErr }
+
+// Every member of the Set. Check Err after the loop.
+func (m *Set) Keys() iter.Seq[Key] {
+    it, err := m.Iterator()
+    return seqKeys(seqOf(it, err, &m.iterErr, nilLookup))
+}
+// Every member of the Set with a nil value, so Sets range like Maps. Check Err after the loop.
+func (m *Set) All() iter.Seq2[Key, []byte] {
+    it, err := m.Iterator()
+    return seqOf(it, err, &m.iterErr, nilLookup)
+}
+// The error that stopped the last Keys or All loop over the Set, if any. Each loop resets it when it starts.
+func (m *Set) Err() error { return m.iterErr }
+
+// The index of every item, starting at 0 on the left. Check Err after the loop.
+func (d *List) Keys() iter.Seq[Key] {
+    it, err := d.Iterator()
+    return seqKeys(seqOf(it, err, &d.iterErr, nilLookup))
+}
+// Every index and item from left to right. Check Err after the loop.
+func (d *List) All() iter.Seq2[Key, []byte] {
+    it, err := d.Iterator()
+    return seqOf(it, err, &d.iterErr, d.LPeek)
+}
+// The error that stopped the last Keys or All loop over the List, if any. Each loop resets it when it starts.
+func (d *List) Err() error { return d.iterErr }
+
+// Every key in the Timeline, ending with the current key. Check Err after the loop.
+func (d *Timeline) Keys() iter.Seq[Key] {
+    it, err := d.Iterator()
+    return seqKeys(seqOf(it, err, &d.iterErr, nilLookup))
+}
+// Every key and value in the Timeline, ending with the current one. Check Err after the loop.
+func (d *Timeline) All() iter.Seq2[Key, []byte] {
+    it, err := d.Iterator()
+    return seqOf(it, err, &d.iterErr, d.Past)
+}
+// The error that stopped the last Keys or All loop over the Timeline, if any. Each loop resets it when it starts.
+func (d *Timeline) Err() error { return d.iterErr }
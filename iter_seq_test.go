@@ -0,0 +1,116 @@
+//go:build go1.23
+
+package bundledb
+
+import (
+    "errors"
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestIterSeq(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 3
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            m, _ := root.FindMap(Key(1))
+            s, _ := root.FindSet(Key(2))
+            l, _ := root.FindList(Key(3))
+            tl, _ := root.FindTimeline(Key(4))
+            for x := 0; x < num; x++ {
+                m.Insert(Key(x), Key(x * 2).Bytes())
+                s.Add(Key(x * 3))
+                l.RPush(Key(x).Bytes())
+                tl.Set(Key(x + 10), Key(x).Bytes())
+            }
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            m, _ := root.FindMap(Key(1))
+            n := 0
+            for k, v := range m.All() {
+                require.Equal(t, Key(n), k)
+                require.Equal(t, Key(n * 2).Bytes(), v)
+                n++
+            }
+            require.NoError(t, m.Err())
+            require.Equal(t, num, n)
+
+            s, _ := root.FindSet(Key(2))
+            members := []Key{}
+            for k := range s.Keys() {
+                if k > Key(10) {
+                    break
+                }
+                members = append(members, k)
+            }
+            require.NoError(t, s.Err())
+            require.Equal(t, []Key{0, 3, 6, 9}, members)
+
+            l, _ := root.FindList(Key(3))
+            n = 0
+            for idx, v := range l.All() {
+                require.Equal(t, Key(n), idx)
+                require.Equal(t, Key(n).Bytes(), v)
+                n++
+            }
+            require.NoError(t, l.Err())
+            require.Equal(t, num, n)
+
+            tl, _ := root.FindTimeline(Key(4))
+            keys := []Key{}
+            for k := range tl.Keys() {
+                keys = append(keys, k)
+            }
+            require.Equal(t, num, len(keys))
+            require.Equal(t, Key(num + 9), keys[len(keys) - 1])
+
+            mit, _ := m.Iterator()
+            sit, _ := s.Iterator()
+            both := []Key{}
+            for k := range Keys(Intersect(mit, sit)) {
+                both = append(both, k)
+            }
+            require.Equal(t, []Key{0, 3, 6, 9, 12, 15, 18, 21, 24, 27}, both)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestIterSeqErr(t *testing.T) {
+    failed := errors.New("failed")
+    broken := func() BundleIterator { return &failingIterator{ListIterator([]Key{1, 2, 3}), failed} }
+
+    it := Intersect(ListIterator([]Key{1, 2, 3, 4}), broken())
+    keys := []Key{}
+    for k, v := range All(it) {
+        require.Nil(t, v)
+        keys = append(keys, k)
+    }
+    require.Equal(t, []Key{1, 2, 3}, keys)
+    require.Equal(t, failed, IterErr(it))
+
+    for _, it := range []BundleIterator{
+        Union(ListIterator([]Key{5}), broken()),
+        Difference(broken(), ListIterator([]Key{2})),
+        Filter(KeyRange(broken(), 0, 10), func(Key) bool { return true }),
+        Limit(broken(), 5),
+        Chain(broken(), ListIterator([]Key{4})),
+    } {
+        Collect(it, -1)
+        require.Equal(t, failed, IterErr(it))
+    }
+}
@@ -0,0 +1,149 @@
+package bundledb
+
+import (
+    "errors"
+    "math"
+    "time"
+)
+
+const (
+    signBit = uint64(1) << 63
+)
+
+var (
+    KeyTooLong = errors.New("Value is too long to fit in a Key")
+    InvalidKeyLayout = errors.New("Packed Key layout must be between 1 and 64 bits")
+    KeyFieldOverflow = errors.New("Value does not fit in its Key field")
+)
+
+// Like BytesToKey, but returns KeyTooLong instead of silently truncating input longer than KeyLength.
+func BytesToKeyStrict(keyFull []byte) (Key, error) {
+    if len(keyFull) > KeyLength {
+        return MinKey, KeyTooLong
+    }
+    return BytesToKey(keyFull), nil
+}
+func StrToKeyStrict(keyFull string) (Key, error) { return BytesToKeyStrict([]byte(keyFull)) }
+
+// Decode a Key made by StrToKey, dropping the zero padding.
+func KeyToStr(pk Key) string {
+    b := pk.Bytes()
+    n := len(b)
+    for n > 0 && b[n - 1] == 0 {
+        n--
+    }
+    return string(b[:n])
+}
+
+// Encode a signed integer so that negative numbers sort before positive ones.
+func Int64ToKey(v int64) Key { return Key(uint64(v) ^ signBit) }
+func KeyToInt64(pk Key) int64 { return int64(uint64(pk) ^ signBit) }
+
+// Encode a float so that Keys sort in numeric order. Negative floats have all bits flipped, positive floats only the sign bit.
+// Every NaN, including ones with the sign bit set, is stored as math.NaN() and sorts above +Inf.
+func Float64ToKey(f float64) Key {
+    if math.IsNaN(f) {
+        f = math.NaN()
+    }
+    bits := math.Float64bits(f)
+    if bits & signBit != 0 {
+        return Key(^bits)
+    }
+    return Key(bits | signBit)
+}
+func KeyToFloat64(pk Key) float64 {
+    bits := uint64(pk)
+    if bits & signBit != 0 {
+        return math.Float64frombits(bits &^ signBit)
+    }
+    return math.Float64frombits(^bits)
+}
+
+// Encode a time as the number of `precision` units since the Unix epoch. Times are truncated toward the past,
+// so every instant inside the same unit maps to the same Key. Precisions of a second or coarser can represent
+// any year time.Time can; finer precisions are limited to the range of UnixNano (years 1678 to 2262).
+func TimeToKey(t time.Time, precision time.Duration) Key {
+    if precision <= 0 {
+        precision = time.Nanosecond
+    }
+    if precision >= time.Second && precision % time.Second == 0 {
+        return Int64ToKey(floorDiv(t.Unix(), int64(precision / time.Second)))
+    }
+    return Int64ToKey(floorDiv(t.UnixNano(), int64(precision)))
+}
+// Decode a Key made by TimeToKey with the same precision. The result is in UTC.
+func KeyToTime(pk Key, precision time.Duration) time.Time {
+    if precision <= 0 {
+        precision = time.Nanosecond
+    }
+    units := KeyToInt64(pk)
+    if precision >= time.Second && precision % time.Second == 0 {
+        return time.Unix(units * int64(precision / time.Second), 0).UTC()
+    }
+    return time.Unix(0, units * int64(precision)).UTC()
+}
+
+func floorDiv(a, b int64) int64 {
+    q := a / b
+    if (a % b != 0) && ((a < 0) != (b < 0)) {
+        q--
+    }
+    return q
+}
+
+// Pack fixed width unsigned fields into one Key, the first field taking the most significant bits.
+// Keys sort by the first field, then the second, and so on. `widths` are bit counts and must sum to at most 64.
+func PackKey(widths []uint, fields ...uint64) (Key, error) {
+    if len(widths) != len(fields) {
+        return MinKey, InvalidKeyLayout
+    }
+    total := uint(0)
+    for _, w := range widths {
+        if w == 0 {
+            return MinKey, InvalidKeyLayout
+        }
+        total += w
+    }
+    if total > 64 {
+        return MinKey, InvalidKeyLayout
+    }
+    var packed uint64
+    for ii, w := range widths {
+        if w < 64 && fields[ii] >> w != 0 {
+            return MinKey, KeyFieldOverflow
+        }
+        if w < 64 {
+            packed <<= w
+        }
+        packed |= fields[ii]
+    }
+    return Key(packed << (64 - total)), nil
+}
+// Reverse of PackKey using the same widths.
+func UnpackKey(pk Key, widths []uint) ([]uint64, error) {
+    total := uint(0)
+    for _, w := range widths {
+        if w == 0 {
+            return nil, InvalidKeyLayout
+        }
+        total += w
+    }
+    if total > 64 {
+        return nil, InvalidKeyLayout
+    }
+    fields := make([]uint64, len(widths))
+    rest := uint64(pk)
+    for ii, w := range widths {
+        if w == 64 {
+            fields[ii] = rest
+            continue
+        }
+        fields[ii] = rest >> (64 - w)
+        rest <<= w
+    }
+    return fields, nil
+}
+
+// Shortcut for the common 32-bit + 32-bit layout.
+func Pack32(hi, lo uint32) Key { return Key(uint64(hi) << 32 | uint64(lo)) }
+func Unpack32(pk Key) (uint32, uint32) { return uint32(pk >> 32), uint32(pk) }
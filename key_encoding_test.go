@@ -0,0 +1,78 @@
+package bundledb
+
+import (
+    "math"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/require"
+)
+
+func TestInt64KeyOrder(t *testing.T) {
+    values := []int64{math.MinInt64, -1000, -1, 0, 1, 1000, math.MaxInt64}
+    for ii, v := range values {
+        require.Equal(t, v, KeyToInt64(Int64ToKey(v)))
+        if ii > 0 {
+            require.True(t, Int64ToKey(values[ii - 1]) < Int64ToKey(v))
+        }
+    }
+}
+
+func TestFloat64KeyOrder(t *testing.T) {
+    values := []float64{math.Inf(-1), -1e10, -1.5, -math.SmallestNonzeroFloat64, 0, math.SmallestNonzeroFloat64, 1.5, 1e10, math.Inf(1)}
+    for ii, v := range values {
+        require.Equal(t, v, KeyToFloat64(Float64ToKey(v)))
+        if ii > 0 {
+            require.True(t, Float64ToKey(values[ii - 1]) < Float64ToKey(v))
+        }
+    }
+}
+
+func TestFloat64KeyNaN(t *testing.T) {
+    negNaN := math.Float64frombits(math.Float64bits(math.NaN()) | 1 << 63)
+    require.True(t, math.Signbit(negNaN))
+    for _, nan := range []float64{math.NaN(), negNaN} {
+        require.Equal(t, Float64ToKey(math.NaN()), Float64ToKey(nan))
+        require.True(t, Float64ToKey(math.Inf(1)) < Float64ToKey(nan))
+        require.True(t, math.IsNaN(KeyToFloat64(Float64ToKey(nan))))
+    }
+}
+
+func TestTimeKey(t *testing.T) {
+    ts := time.Date(1969, 12, 31, 23, 59, 59, 500, time.UTC)
+    require.Equal(t, ts, KeyToTime(TimeToKey(ts, time.Nanosecond), time.Nanosecond))
+    require.Equal(t, ts.Truncate(time.Second), KeyToTime(TimeToKey(ts, time.Second), time.Second))
+    require.Equal(t, time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), KeyToTime(TimeToKey(ts, 24 * time.Hour), 24 * time.Hour))
+
+    far := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+    require.Equal(t, far, KeyToTime(TimeToKey(far, time.Second), time.Second))
+    require.True(t, TimeToKey(ts, time.Millisecond) < TimeToKey(ts.Add(time.Millisecond), time.Millisecond))
+}
+
+func TestPackKey(t *testing.T) {
+    widths := []uint{16, 32, 8}
+    k, err := PackKey(widths, 1, 2, 3)
+    require.NoError(t, err)
+    fields, err := UnpackKey(k, widths)
+    require.NoError(t, err)
+    require.Equal(t, []uint64{1, 2, 3}, fields)
+
+    k2, _ := PackKey(widths, 1, 3, 0)
+    require.True(t, k < k2)
+
+    _, err = PackKey(widths, 1 << 16, 0, 0)
+    require.Equal(t, KeyFieldOverflow, err)
+    _, err = PackKey([]uint{32, 33}, 0, 0)
+    require.Equal(t, InvalidKeyLayout, err)
+
+    hi, lo := Unpack32(Pack32(7, 9))
+    require.Equal(t, uint32(7), hi)
+    require.Equal(t, uint32(9), lo)
+}
+
+func TestStrictStrKey(t *testing.T) {
+    k, err := StrToKeyStrict("hello")
+    require.NoError(t, err)
+    require.Equal(t, "hello", KeyToStr(k))
+    _, err = StrToKeyStrict("hello world")
+    require.Equal(t, KeyTooLong, err)
+}
@@ -0,0 +1,124 @@
+package bundledb
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+)
+
+var (
+    NotAnInteger = errors.New("Value is not an 8 byte integer")
+)
+
+// Replace the value under `key` with the result of `fn`, or delete it if `fn` returns true for `del`. The shard
+// holding `key` is only found once. `fn` gets expired entries as missing and blobs read in full, and must not use
+// the Map itself. An entry with a TTL keeps its expiry, and a blob or a value over MAX_INLINE_VALUE_BYTES is written
+// as a new blob.
+func (m *Map) Update(key Key, fn func(old []byte, exists bool) (new []byte, del bool)) error {
+    return m.update(key, func(old []byte, exists bool) ([]byte, bool, bool) {
+        new, del := fn(old, exists)
+        return new, del, true
+    })
+}
+
+// Like Update, but nothing is written when `fn` returns false for `change`.
+func (m *Map) update(key Key, fn func(old []byte, exists bool) (new []byte, del bool, change bool)) error {
+    prim, err := m.bund.Primitive(key)
+    if err != nil {
+        return err
+    }
+    var old []byte
+    exists := false
+    val, found := prim.Read(key)
+    ref, isBlob := blobRef{}, false
+    expires, hasTTL := Key(0), false
+    if found && val != nil {
+        b := val.Bytes()
+        if ref, isBlob = blobRefFromBytes(b); isBlob {
+            if old, err = (&Blob{m.bund.txn, ref}).Bytes(); err != nil {
+                return err
+            }
+            exists = true
+        } else {
+            old, exists = userBytes(b)
+            if hasTTL = b[0] == headerUserExpiring && len(b) >= 1 + KeyLength; hasTTL {
+                expires = BytesToKey(b[1:1 + KeyLength])
+            }
+        }
+    }
+    newVal, del, change := fn(old, exists)
+    if !change {
+        return nil
+    }
+    // A live entry keeps its expiry, so its index row stays. An expired one is replaced by a permanent value.
+    if hasTTL && (del || !exists) {
+        if err := m.bund.txn.Delete(expireIndexKey(expires, m.path(key))); err != nil {
+            return err
+        }
+    }
+    if isBlob {
+        if err := dropBlobAt(m.bund.txn, m.path(key), ref); err != nil {
+            return err
+        }
+    }
+    if del {
+        prim.Delete(key)
+        return nil
+    }
+    var v Value = UserVal(newVal)
+    switch {
+    case hasTTL && exists:
+        v = expiringVal{expires, newVal}
+    case isBlob || len(newVal) > MAX_INLINE_VALUE_BYTES:
+        newRef, err := writeBlob(m.bund.txn, newVal)
+        if err != nil {
+            return err
+        }
+        if err := indexBlob(m.bund.txn, m.path(key), newRef); err != nil {
+            return err
+        }
+        v = newRef
+    }
+    prim.Write(key, v)
+    return m.bund.wrote(prim)
+}
+
+// Set `key` to `new` only if it currently holds `old`. A nil `old` means the key must be missing.
+// Returns true if the value was swapped.
+func (m *Map) CompareAndSwap(key Key, old, new []byte) (bool, error) {
+    swapped := false
+    err := m.update(key, func(cur []byte, exists bool) ([]byte, bool, bool) {
+        swapped = exists == (old != nil) && bytes.Equal(cur, old)
+        return new, false, swapped
+    })
+    return swapped, err
+}
+
+// Insert `val` only if `key` is missing. Returns true if it was inserted.
+func (m *Map) InsertIfAbsent(key Key, val []byte) (bool, error) {
+    return m.CompareAndSwap(key, nil, val)
+}
+
+// Add `delta` to the integer under `key`, treating a missing key as 0, and return the new value. Integers are
+// stored as 8 big endian bytes. Returns NotAnInteger if `key` holds something else.
+func (m *Map) IncrBy(key Key, delta int64) (int64, error) {
+    var result int64
+    var valErr error
+    err := m.update(key, func(cur []byte, exists bool) ([]byte, bool, bool) {
+        if exists && len(cur) != 8 {
+            valErr = NotAnInteger
+            return nil, false, false
+        }
+        if exists {
+            result = int64(binary.BigEndian.Uint64(cur))
+        }
+        result += delta
+        b := make([]byte, 8)
+        binary.BigEndian.PutUint64(b, uint64(result))
+        return b, false, true
+    })
+    if valErr != nil {
+        return 0, valErr
+    }
+    return result, err
+}
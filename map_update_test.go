@@ -0,0 +1,141 @@
+package bundledb
+
+import (
+    "bytes"
+    "testing"
+    "time"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestMapUpdate(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+
+            inserted, err := m.InsertIfAbsent(Key(1), []byte("a"))
+            require.NoError(t, err)
+            require.True(t, inserted)
+            inserted, err = m.InsertIfAbsent(Key(1), []byte("b"))
+            require.NoError(t, err)
+            require.False(t, inserted)
+
+            swapped, err := m.CompareAndSwap(Key(1), []byte("b"), []byte("c"))
+            require.NoError(t, err)
+            require.False(t, swapped)
+            swapped, err = m.CompareAndSwap(Key(1), []byte("a"), []byte("c"))
+            require.NoError(t, err)
+            require.True(t, swapped)
+
+            require.NoError(t, m.Update(Key(1), func(old []byte, exists bool) ([]byte, bool) {
+                require.True(t, exists)
+                return append(old, 'd'), false
+            }))
+            require.NoError(t, m.Update(Key(2), func(old []byte, exists bool) ([]byte, bool) {
+                require.False(t, exists)
+                return nil, true
+            }))
+
+            for ii := 0; ii < 5; ii++ {
+                _, err = m.IncrBy(Key(3), 2)
+                require.NoError(t, err)
+            }
+            n, err := m.IncrBy(Key(3), -15)
+            require.NoError(t, err)
+            require.Equal(t, int64(-5), n)
+            _, err = m.IncrBy(Key(1), 1)
+            require.Equal(t, NotAnInteger, err)
+
+            // Replacing a blob drops its old chunks.
+            _, err = m.InsertBlob(Key(4), bytes.NewReader(make([]byte, BLOB_CHUNK_BYTES * 2)))
+            require.NoError(t, err)
+            require.NoError(t, m.Update(Key(4), func(old []byte, exists bool) ([]byte, bool) {
+                require.Equal(t, BLOB_CHUNK_BYTES * 2, len(old))
+                return []byte("small"), false
+            }))
+            return m.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+
+            val, _, err := m.Lookup(Key(1))
+            require.NoError(t, err)
+            require.Equal(t, []byte("cd"), val)
+            _, exists, err := m.Lookup(Key(2))
+            require.NoError(t, err)
+            require.False(t, exists)
+            val, _, err = m.Lookup(Key(4))
+            require.NoError(t, err)
+            require.Equal(t, []byte("small"), val)
+
+            return nil
+        })
+        require.NoError(t, err)
+        // Only the chunk of the new blob is left.
+        require.Equal(t, 1, tableRows(t, db, tableBlob))
+    })
+}
+
+func TestMapUpdateKeepsEncoding(t *testing.T) {
+    big := bytes.Repeat([]byte("x"), BLOB_CHUNK_BYTES * 3)
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+
+            _, err = m.InsertWithTTL(Key(1), []byte{0, 0, 0, 0, 0, 0, 0, 1}, time.Hour)
+            require.NoError(t, err)
+            n, err := m.IncrBy(Key(1), 1)
+            require.NoError(t, err)
+            require.Equal(t, int64(2), n)
+            // The TTL survives the update.
+            left, ok, err := m.TTL(Key(1))
+            require.NoError(t, err)
+            require.True(t, ok)
+            require.True(t, left > time.Minute)
+
+            _, err = m.InsertBlob(Key(2), bytes.NewReader([]byte("small")))
+            require.NoError(t, err)
+            err = m.Update(Key(2), func(old []byte, exists bool) ([]byte, bool) {
+                return append(old, big...), false
+            })
+            require.NoError(t, err)
+            // The value is still stored out of line, whatever its size.
+            blob, exists, err := m.OpenBlob(Key(2))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, int64(len(big) + 5), blob.Size())
+            return m.Commit()
+        })
+        require.NoError(t, err)
+        require.Equal(t, 1, tableRows(t, db, tableExpire))
+        require.Equal(t, 4, tableRows(t, db, tableBlob))
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            for _, key := range []Key{Key(1), Key(2)} {
+                err = m.Update(key, func(old []byte, exists bool) ([]byte, bool) {
+                    return nil, true
+                })
+                require.NoError(t, err)
+            }
+            return m.Commit()
+        })
+        require.NoError(t, err)
+        // Deleting releases the index row and the chunks.
+        require.Equal(t, 0, tableRows(t, db, tableExpire))
+        require.Equal(t, 0, tableRows(t, db, tableBlob))
+    })
+}
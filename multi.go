@@ -1,6 +1,8 @@
 package bundledb
 
 import (
+    "container/heap"
+    "math"
     "sort"
 )
 
@@ -9,47 +11,146 @@ func ListIterator(keys []Key) BundleIterator {
     return &primIterator{keys, 0}
 }
 
+const (
+    unknownSize = math.MaxInt32
+)
+
+// An iterator that can cheaply estimate how many keys it holds. Intersect seeks the smallest iterators first.
+type SizedIterator interface {
+    BundleIterator
+    EstimatedSize() int
+}
+
+func estimatedSize(it BundleIterator) int {
+    if sized, ok := it.(SizedIterator); ok {
+        return sized.EstimatedSize()
+    }
+    return unknownSize
+}
+
+// An iterator that can fail while reading, like one over a sharded bundle. It stops being valid at the first error,
+// which Err returns.
+type ErrIterator interface {
+    BundleIterator
+    Err() error
+}
+
+// The error that stopped `it` or one of the iterators it reads from, if any. Check it after a loop ends.
+func IterErr(it BundleIterator) error {
+    if e, ok := it.(ErrIterator); ok {
+        return e.Err()
+    }
+    return nil
+}
+
+func firstErr(its []BundleIterator) error {
+    for _, i := range its {
+        if err := IterErr(i); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func sumSizes(its []BundleIterator) int {
+    tot := 0
+    for _, i := range its {
+        tot += estimatedSize(i)
+        if tot >= unknownSize {
+            return unknownSize
+        }
+    }
+    return tot
+}
+
 type intersectIterator struct {
     key Key
     isValid bool
+    ordered bool
     iterators []BundleIterator
 }
 // Compute a Set Intersection
 func Intersect(its ...BundleIterator) BundleIterator {
-    return &intersectIterator{isValid: true, iterators: its}
+    return &intersectIterator{isValid: true, iterators: append([]BundleIterator{}, its...)}
 }
 func (it *intersectIterator) IsValid() bool { return it.isValid }
 func (it *intersectIterator) Key() Key { return it.key }
+func (it *intersectIterator) Err() error { return firstErr(it.iterators) }
+func (it *intersectIterator) EstimatedSize() int {
+    min := unknownSize
+    for _, i := range it.iterators {
+        if s := estimatedSize(i); s < min {
+            min = s
+        }
+    }
+    return min
+}
 func (it *intersectIterator) Next() {
     if it.isValid {
-        curKey := it.key + 1
-        it.Seek(curKey)
+        if it.key == MaxKey {
+            it.isValid = false
+            return
+        }
+        it.Seek(it.key + 1)
     }
 }
+// The smallest iterator leads. Every other iterator seeks to its key and if one lands past it,
+// the leader jumps ahead to that key, skipping everything in between.
 func (it *intersectIterator) Seek(key Key) {
-    searching := true
-    for searching {
-        searching = false
-
-        for _, i := range it.iterators {
+    if len(it.iterators) == 0 {
+        it.isValid = false
+        return
+    }
+    if !it.ordered {
+        sort.SliceStable(it.iterators, func(i, j int) bool {
+            return estimatedSize(it.iterators[i]) < estimatedSize(it.iterators[j])
+        })
+        it.ordered = true
+    }
+    lead := it.iterators[0]
+    lead.Seek(key)
+    for lead.IsValid() {
+        key = lead.Key()
+        matched := true
+        for _, i := range it.iterators[1:] {
             i.Seek(key)
             if !i.IsValid() {
                 it.isValid = false
                 return
             }
             if i.Key() > key {
-                key = i.Key()
-                searching = true
+                lead.Seek(i.Key())
+                matched = false
                 break
             }
         }
+        if matched {
+            it.key = key
+            it.isValid = true
+            return
+        }
     }
-    it.key = key
+    it.isValid = false
+}
+
+// A min-heap of positioned iterators ordered by their current key.
+type iteratorHeap []BundleIterator
+func (h iteratorHeap) Len() int { return len(h) }
+func (h iteratorHeap) Less(i, j int) bool { return h[i].Key() < h[j].Key() }
+func (h iteratorHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *iteratorHeap) Push(x interface{}) { *h = append(*h, x.(BundleIterator)) }
+func (h *iteratorHeap) Pop() interface{} {
+    old := *h
+    n := len(old)
+    x := old[n - 1]
+    *h = old[:n - 1]
+    return x
 }
 
 type unionIterator struct {
     key Key
     isValid bool
+    heap iteratorHeap
     iterators []BundleIterator
 }
 // Compute a Set Union
@@ -58,54 +159,157 @@ func Union(its ...BundleIterator) BundleIterator {
 }
 func (it *unionIterator) IsValid() bool { return it.isValid }
 func (it *unionIterator) Key() Key { return it.key }
+func (it *unionIterator) Err() error { return firstErr(it.iterators) }
+func (it *unionIterator) EstimatedSize() int { return sumSizes(it.iterators) }
 func (it *unionIterator) Next() {
+    if it.heap == nil {
+        it.Seek(MinKey)
+        return
+    }
     if it.isValid {
-        validFound := false
-        for _, i := range it.iterators {
-            if i.IsValid() {
-                if i.Key() <= it.key {
-                    i.Next()
-                    if i.IsValid() {
-                        validFound = true
-                    }
-                } else {
-                    validFound = true
-                    break
-                }
+        for len(it.heap) > 0 && it.heap[0].Key() == it.key {
+            top := it.heap[0]
+            top.Next()
+            if top.IsValid() {
+                heap.Fix(&it.heap, 0)
+            } else {
+                heap.Pop(&it.heap)
             }
         }
-        if validFound {
-            it.setKey()
-        }
-        it.isValid = validFound
+        it.setKey()
     }
 }
 func (it *unionIterator) Seek(key Key) {
-    validFound := false
+    it.heap = make(iteratorHeap, 0, len(it.iterators))
     for _, i := range it.iterators {
         i.Seek(key)
         if i.IsValid() {
-            validFound = true
+            it.heap = append(it.heap, i)
         }
     }
-    if validFound {
-        it.setKey()
-    }
-    it.isValid = validFound
+    heap.Init(&it.heap)
+    it.setKey()
 }
 func (it *unionIterator) setKey() {
-    sort.SliceStable(it.iterators, func(i, j int) bool {
-        switch {
-        case !it.iterators[i].IsValid():
-            return false
-        case !it.iterators[j].IsValid():
-            return true
-        default:
-            return it.iterators[i].Key() < it.iterators[j].Key()
+    it.isValid = len(it.heap) > 0
+    if it.isValid {
+        it.key = it.heap[0].Key()
+    }
+}
+
+type differenceIterator struct {
+    key Key
+    isValid bool
+    base BundleIterator
+    exclude []BundleIterator
+}
+// Compute a Set Difference, the keys of `base` that aren't in any of `exclude`
+func Difference(base BundleIterator, exclude ...BundleIterator) BundleIterator {
+    return &differenceIterator{isValid: true, base: base, exclude: exclude}
+}
+func (it *differenceIterator) IsValid() bool { return it.isValid }
+func (it *differenceIterator) Key() Key { return it.key }
+func (it *differenceIterator) Err() error {
+    if err := IterErr(it.base); err != nil {
+        return err
+    }
+    return firstErr(it.exclude)
+}
+func (it *differenceIterator) EstimatedSize() int { return estimatedSize(it.base) }
+func (it *differenceIterator) Next() {
+    if it.isValid {
+        it.base.Next()
+        it.skipExcluded()
+    }
+}
+func (it *differenceIterator) Seek(key Key) {
+    it.base.Seek(key)
+    it.skipExcluded()
+}
+// Advance base until it is on a key that no excluded iterator has. Excluded iterators only ever move forward.
+func (it *differenceIterator) skipExcluded() {
+    for it.base.IsValid() {
+        key := it.base.Key()
+        excluded := false
+        for _, i := range it.exclude {
+            i.Seek(key)
+            if i.IsValid() && i.Key() == key {
+                excluded = true
+                break
+            }
+        }
+        if !excluded {
+            it.key = key
+            it.isValid = true
+            return
+        }
+        it.base.Next()
+    }
+    it.isValid = false
+}
+
+type symmetricDifferenceIterator struct {
+    key Key
+    isValid bool
+    iterators []BundleIterator
+}
+// Compute a Symmetric Difference, the keys that are in exactly one of `its`
+func SymmetricDifference(its ...BundleIterator) BundleIterator {
+    return &symmetricDifferenceIterator{isValid: true, iterators: its}
+}
+func (it *symmetricDifferenceIterator) IsValid() bool { return it.isValid }
+func (it *symmetricDifferenceIterator) Key() Key { return it.key }
+func (it *symmetricDifferenceIterator) Err() error { return firstErr(it.iterators) }
+func (it *symmetricDifferenceIterator) EstimatedSize() int { return sumSizes(it.iterators) }
+func (it *symmetricDifferenceIterator) Next() {
+    if it.isValid {
+        for _, i := range it.iterators {
+            if i.IsValid() && i.Key() == it.key {
+                i.Next()
+            }
+        }
+        it.settle()
+    }
+}
+func (it *symmetricDifferenceIterator) Seek(key Key) {
+    for _, i := range it.iterators {
+        i.Seek(key)
+    }
+    it.settle()
+}
+// Find the smallest key held by only one iterator, stepping past keys that several iterators share.
+func (it *symmetricDifferenceIterator) settle() {
+    for {
+        found := false
+        min := MaxKey
+        count := 0
+        for _, i := range it.iterators {
+            if !i.IsValid() {
+                continue
+            }
+            switch k := i.Key(); {
+            case !found || k < min:
+                found = true
+                min = k
+                count = 1
+            case k == min:
+                count++
+            }
+        }
+        if !found {
+            it.isValid = false
+            return
+        }
+        if count == 1 {
+            it.key = min
+            it.isValid = true
+            return
+        }
+        for _, i := range it.iterators {
+            if i.IsValid() && i.Key() == min {
+                i.Next()
+            }
         }
-    })
-    if it.iterators[0].IsValid() {
-        it.key = it.iterators[0].Key()
     }
 }
 
@@ -122,6 +326,8 @@ func Chain(its ...BundleIterator) BundleIterator {
 }
 func (it *chainIterator) IsValid() bool { return it.isValid }
 func (it *chainIterator) Key() Key { return it.key }
+func (it *chainIterator) Err() error { return firstErr(it.iterators) }
+func (it *chainIterator) EstimatedSize() int { return sumSizes(it.iterators) }
 func (it *chainIterator) Next() {
     if it.isValid {
         found := false
@@ -158,4 +364,60 @@ func (pit *nilIterator) Next() {}
 func (pit *nilIterator) IsValid() bool { return false }
 func (pit *nilIterator) Key() Key { return MinKey }
 func (pit *nilIterator) Seek(item Key) {}
+func (pit *nilIterator) EstimatedSize() int { return 0 }
 func NilIterator() BundleIterator { return &nilIterator{} }
+
+// Replace the members of `dest` with the keys of `it`, like SINTERSTORE and friends. The result is read in full
+// before `dest` is cleared, so `dest` may also be one of the sources. Returns the number of members written. If
+// reading `it` or `dest` fails, `dest` is left as it was.
+func Store(dest *Set, it BundleIterator) (int, error) {
+    keys := []Key{}
+    for it.Seek(MinKey); it.IsValid(); it.Next() {
+        keys = append(keys, it.Key())
+    }
+    if err := IterErr(it); err != nil {
+        return 0, err
+    }
+    existing, err := dest.Iterator()
+    if err != nil {
+        return 0, err
+    }
+    old := []Key{}
+    for existing.Seek(MinKey); existing.IsValid(); existing.Next() {
+        old = append(old, existing.Key())
+    }
+    if err := IterErr(existing); err != nil {
+        return 0, err
+    }
+    for _, key := range old {
+        if _, err := dest.Remove(key); err != nil {
+            return 0, err
+        }
+    }
+    for _, key := range keys {
+        if _, err := dest.Add(key); err != nil {
+            return 0, err
+        }
+    }
+    return len(keys), nil
+}
+
+// Store the intersection of `its` in `dest`.
+func IntersectStore(dest *Set, its ...BundleIterator) (int, error) {
+    return Store(dest, Intersect(its...))
+}
+
+// Store the union of `its` in `dest`.
+func UnionStore(dest *Set, its ...BundleIterator) (int, error) {
+    return Store(dest, Union(its...))
+}
+
+// Store the keys of `base` that aren't in `exclude` in `dest`.
+func DifferenceStore(dest *Set, base BundleIterator, exclude ...BundleIterator) (int, error) {
+    return Store(dest, Difference(base, exclude...))
+}
+
+// Store the keys that are in exactly one of `its` in `dest`.
+func SymmetricDifferenceStore(dest *Set, its ...BundleIterator) (int, error) {
+    return Store(dest, SymmetricDifference(its...))
+}
@@ -1,6 +1,9 @@
 package bundledb
 
 import (
+    "errors"
+    "fmt"
+    "sort"
     "testing"
     "github.com/hansonkd/bundledb/store"
     "github.com/hansonkd/bundledb/store/badger"
@@ -76,3 +79,301 @@ func TestIntersectIterator(t *testing.T) {
         require.NoError(t, err)
     })
 }
+
+func TestDifferenceIterators(t *testing.T) {
+    collect := func(it BundleIterator) []Key {
+        keys := []Key{}
+        for it.Seek(MinKey); it.IsValid(); it.Next() {
+            keys = append(keys, it.Key())
+        }
+        return keys
+    }
+    diff := Difference(ListIterator([]Key{1, 2, 3, 4, 5, 6}), ListIterator([]Key{2, 3}), ListIterator([]Key{3, 6, 9}))
+    require.Equal(t, []Key{1, 4, 5}, collect(diff))
+    diff.Seek(Key(2))
+    require.Equal(t, Key(4), diff.Key())
+    require.Equal(t, []Key{1, 2}, collect(Difference(ListIterator([]Key{1, 2}))))
+
+    sym := SymmetricDifference(ListIterator([]Key{1, 2, 3}), ListIterator([]Key{2, 3, 4}), ListIterator([]Key{3, 5}))
+    require.Equal(t, []Key{1, 4, 5}, collect(sym))
+    require.Equal(t, []Key{}, collect(SymmetricDifference(ListIterator([]Key{1}), ListIterator([]Key{1}))))
+
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            a, _ := root.FindSet(Key(1))
+            b, _ := root.FindSet(Key(2))
+            for x := 0; x < MAX_SHARD_SET_SIZE * 3; x++ {
+                a.Add(Key(x))
+                if x % 2 == 0 {
+                    b.Add(Key(x))
+                }
+            }
+            dest, _ := root.FindSet(Key(3))
+            dest.Add(Key(1000))
+
+            ait, _ := a.Iterator()
+            bit, _ := b.Iterator()
+            n, err := DifferenceStore(dest, ait, bit)
+            require.NoError(t, err)
+            require.Equal(t, MAX_SHARD_SET_SIZE * 3 / 2, n)
+            contains, _ := dest.Contains(Key(1000))
+            require.False(t, contains)
+
+            // The destination can also be a source.
+            dit, _ := dest.Iterator()
+            bit, _ = b.Iterator()
+            n, err = UnionStore(dest, dit, bit)
+            require.NoError(t, err)
+            require.Equal(t, MAX_SHARD_SET_SIZE * 3, n)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            dest, _ := root.FindSet(Key(3))
+            it, _ := dest.Iterator()
+            require.Equal(t, MAX_SHARD_SET_SIZE * 3, len(collect(it)))
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+// Reports `err` once its keys run out, like a sharded iterator that failed to load the next shard.
+type failingIterator struct {
+    BundleIterator
+    err error
+}
+func (f *failingIterator) Err() error {
+    if f.IsValid() {
+        return nil
+    }
+    return f.err
+}
+
+func TestStoreIteratorErr(t *testing.T) {
+    failed := errors.New("failed")
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            dest, _ := root.FindSet(Key(1))
+            dest.Add(Key(1000))
+            // A source that stops early must not replace `dest` with a partial result.
+            _, err = UnionStore(dest, ListIterator([]Key{1}), &failingIterator{ListIterator([]Key{2, 3}), failed})
+            require.Equal(t, failed, err)
+            it, _ := dest.Iterator()
+            require.Equal(t, []Key{1000}, Collect(it, -1))
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+// Write `numSets` sharded sets where set ii holds every multiple of ii + 1 below `size`, plus one small set of a
+// few shards at key `numSets`.
+func writeBenchSets(b *testing.B, db *store.DB, numSets int, size int) {
+    err := db.Update([]byte("bench"), func(txn *store.Txn) error {
+        root, err := GetRootBundle(Key(0), txn)
+        require.NoError(b, err)
+        defer root.Close()
+        for ii := 0; ii < numSets; ii++ {
+            s, err := root.FindSet(Key(ii))
+            require.NoError(b, err)
+            for x := 0; x < size; x += ii + 1 {
+                s.Add(Key(x))
+            }
+        }
+        small, err := root.FindSet(Key(numSets))
+        require.NoError(b, err)
+        for x := 0; x < MAX_SHARD_SET_SIZE * 3; x++ {
+            small.Add(Key(x * 397))
+        }
+        return root.Commit()
+    })
+    require.NoError(b, err)
+}
+
+func benchIterators(b *testing.B, root *Root, keys ...int) []BundleIterator {
+    its := make([]BundleIterator, len(keys))
+    for ii, k := range keys {
+        s, err := root.FindSet(Key(k))
+        require.NoError(b, err)
+        its[ii], err = s.Iterator()
+        require.NoError(b, err)
+    }
+    return its
+}
+
+func benchKeys(n int) []int {
+    keys := make([]int, n)
+    for ii := range keys {
+        keys[ii] = ii
+    }
+    return keys
+}
+
+// The Union and Intersect this package used before the heap and galloping versions, kept to benchmark against.
+type legacyIntersectIterator struct {
+    key Key
+    isValid bool
+    iterators []BundleIterator
+}
+func (it *legacyIntersectIterator) IsValid() bool { return it.isValid }
+func (it *legacyIntersectIterator) Key() Key { return it.key }
+func (it *legacyIntersectIterator) Next() {
+    if it.isValid {
+        it.Seek(it.key + 1)
+    }
+}
+func (it *legacyIntersectIterator) Seek(key Key) {
+    searching := true
+    for searching {
+        searching = false
+        for _, i := range it.iterators {
+            i.Seek(key)
+            if !i.IsValid() {
+                it.isValid = false
+                return
+            }
+            if i.Key() > key {
+                key = i.Key()
+                searching = true
+                break
+            }
+        }
+    }
+    it.key = key
+}
+
+type legacyUnionIterator struct {
+    key Key
+    isValid bool
+    iterators []BundleIterator
+}
+func (it *legacyUnionIterator) IsValid() bool { return it.isValid }
+func (it *legacyUnionIterator) Key() Key { return it.key }
+func (it *legacyUnionIterator) Next() {
+    if it.isValid {
+        validFound := false
+        for _, i := range it.iterators {
+            if i.IsValid() {
+                if i.Key() <= it.key {
+                    i.Next()
+                    if i.IsValid() {
+                        validFound = true
+                    }
+                } else {
+                    validFound = true
+                    break
+                }
+            }
+        }
+        if validFound {
+            it.setKey()
+        }
+        it.isValid = validFound
+    }
+}
+func (it *legacyUnionIterator) Seek(key Key) {
+    validFound := false
+    for _, i := range it.iterators {
+        i.Seek(key)
+        if i.IsValid() {
+            validFound = true
+        }
+    }
+    if validFound {
+        it.setKey()
+    }
+    it.isValid = validFound
+}
+func (it *legacyUnionIterator) setKey() {
+    sort.SliceStable(it.iterators, func(i, j int) bool {
+        switch {
+        case !it.iterators[i].IsValid():
+            return false
+        case !it.iterators[j].IsValid():
+            return true
+        default:
+            return it.iterators[i].Key() < it.iterators[j].Key()
+        }
+    })
+    if it.iterators[0].IsValid() {
+        it.key = it.iterators[0].Key()
+    }
+}
+
+var (
+    unionImpls = map[string]func(...BundleIterator) BundleIterator{
+        "heap": Union,
+        "legacy": func(its ...BundleIterator) BundleIterator { return &legacyUnionIterator{isValid: true, iterators: its} },
+    }
+    intersectImpls = map[string]func(...BundleIterator) BundleIterator{
+        "gallop": Intersect,
+        "legacy": func(its ...BundleIterator) BundleIterator { return &legacyIntersectIterator{isValid: true, iterators: its} },
+    }
+)
+
+func BenchmarkUnion(b *testing.B) {
+    for _, numSets := range []int{2, 8, 32} {
+        for _, impl := range []string{"heap", "legacy"} {
+            union := unionImpls[impl]
+            b.Run(fmt.Sprintf("sets=%d/impl=%s", numSets, impl), func(b *testing.B) {
+                badger.RunBadgerBench(b, []byte("union"), func(b *testing.B, idb store.IDB) {
+                    db := store.NewDB(idb)
+                    writeBenchSets(b, db, numSets, 2000)
+                    db.View([]byte("bench"), func(txn *store.Txn) error {
+                        root, err := GetRootBundle(Key(0), txn)
+                        require.NoError(b, err)
+                        defer root.Close()
+                        b.ResetTimer()
+                        for n := 0; n < b.N; n++ {
+                            it := union(benchIterators(b, root, benchKeys(numSets)...)...)
+                            for it.Seek(MinKey); it.IsValid(); it.Next() {}
+                        }
+                        return nil
+                    })
+                })
+            })
+        }
+    }
+}
+
+func BenchmarkIntersect(b *testing.B) {
+    for _, numSets := range []int{2, 8, 32} {
+        for _, impl := range []string{"gallop", "legacy"} {
+            intersect := intersectImpls[impl]
+            b.Run(fmt.Sprintf("sets=%d/impl=%s", numSets, impl), func(b *testing.B) {
+                badger.RunBadgerBench(b, []byte("intersect"), func(b *testing.B, idb store.IDB) {
+                    db := store.NewDB(idb)
+                    writeBenchSets(b, db, numSets, 2000)
+                    db.View([]byte("bench"), func(txn *store.Txn) error {
+                        root, err := GetRootBundle(Key(0), txn)
+                        require.NoError(b, err)
+                        defer root.Close()
+                        b.ResetTimer()
+                        for n := 0; n < b.N; n++ {
+                            // The small set is passed last, it should still lead.
+                            it := intersect(benchIterators(b, root, append(benchKeys(numSets), numSets)...)...)
+                            for it.Seek(MinKey); it.IsValid(); it.Next() {}
+                        }
+                        return nil
+                    })
+                })
+            })
+        }
+    }
+}
@@ -0,0 +1,220 @@
+package bundledb
+
+import (
+    "errors"
+)
+
+const (
+    MultiMapForward = TupleLeft
+    MultiMapReverse = TupleRight
+    headerMultiMap = byte(42)
+    // A MultiMap with a reverse index. The header records it so every handle keeps the index up to date.
+    headerMultiMapReverse = byte(43)
+)
+
+var (
+    NoReverseIndex = errors.New("MultiMap doesn't have a reverse index")
+)
+
+type MultiMapOptions struct {
+    // Maintain value -> keys alongside key -> values. It is stored with the MultiMap, so once turned on every handle
+    // maintains it, and turning it on for a MultiMap with entries builds it from them.
+    Reverse bool
+}
+
+type multiMapType struct {
+    tupleType
+}
+func (x multiMapType) IsPrimitive(b []byte) bool {
+    return x.tupleType.IsPrimitive(b) || b[0] == headerMultiMapReverse
+}
+
+// A MultiMap maps each Key to a Set of Keys, which makes it a natural secondary index. It is a Tuple holding a Map of
+// key -> Set and, optionally, a Map of value -> Set for reverse lookups. Sets are deleted as soon as they are empty.
+type MultiMap struct {
+    bund *Bundle
+    forward *Bundle
+    reverse *Bundle
+}
+
+func multiMapFromBundle(bund *Bundle, opts MultiMapOptions) (*MultiMap, error) {
+    forward, err := bund.FindBundle(DecodeMap, MultiMapForward)
+    if err != nil {
+        return nil, err
+    }
+    mm := &MultiMap{bund, forward, nil}
+    prim, err := bund.Primitive(MultiMapForward)
+    if err != nil {
+        return nil, err
+    }
+    ptuple := prim.(*primTuple)
+    if ptuple.header != headerMultiMapReverse && !(opts.Reverse && bund.txn.CanWrite()) {
+        return mm, nil
+    }
+    mm.reverse, err = bund.FindBundle(DecodeMap, MultiMapReverse)
+    if err != nil {
+        return nil, err
+    }
+    if ptuple.header != headerMultiMapReverse {
+        ptuple.header = headerMultiMapReverse
+        ptuple.dirty = true
+        if err := mm.buildReverse(); err != nil {
+            return nil, err
+        }
+    }
+    return mm, nil
+}
+
+// Fill the reverse index from the entries written before it was turned on.
+func (mm *MultiMap) buildReverse() error {
+    it, err := mm.forward.Iterator()
+    if err != nil {
+        return err
+    }
+    keys := []Key{}
+    for it.Seek(MinKey); it.IsValid(); it.Next() {
+        keys = append(keys, it.Key())
+    }
+    for _, key := range keys {
+        values, err := mm.collect(mm.forward, key)
+        if err != nil {
+            return err
+        }
+        for _, value := range values {
+            rs, err := mm.reverse.FindSet(value)
+            if err != nil {
+                return err
+            }
+            if _, err := rs.Add(key); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// Add `value` to the Set under `key`, returning true if it was already there.
+func (mm *MultiMap) Add(key Key, value Key) (bool, error) {
+    s, err := mm.forward.FindSet(key)
+    if err != nil {
+        return false, err
+    }
+    exists, err := s.Add(value)
+    if err != nil || exists || mm.reverse == nil {
+        return exists, err
+    }
+    rs, err := mm.reverse.FindSet(value)
+    if err != nil {
+        return false, err
+    }
+    _, err = rs.Add(key)
+    return false, err
+}
+
+// Remove `value` from the Set under `key`, returning true if it was there.
+func (mm *MultiMap) Remove(key Key, value Key) (bool, error) {
+    exists, err := mm.forward.removeFromChildSet(key, value)
+    if err != nil || !exists || mm.reverse == nil {
+        return exists, err
+    }
+    _, err = mm.reverse.removeFromChildSet(value, key)
+    return true, err
+}
+
+// Remove every value under `key`, returning how many there were.
+func (mm *MultiMap) RemoveKey(key Key) (int, error) {
+    values, err := mm.collect(mm.forward, key)
+    if err != nil {
+        return 0, err
+    }
+    if mm.reverse != nil {
+        for _, value := range values {
+            if _, err := mm.reverse.removeFromChildSet(value, key); err != nil {
+                return 0, err
+            }
+        }
+    }
+    if len(values) > 0 {
+        _, err = mm.forward.DeleteChild(key)
+    }
+    return len(values), err
+}
+
+// Iterate over the values under `key`.
+func (mm *MultiMap) Get(key Key) (BundleIterator, error) {
+    return mm.iterator(mm.forward, key)
+}
+
+// Iterate over the keys that have `value`. Only available once the reverse index is turned on.
+func (mm *MultiMap) GetReverse(value Key) (BundleIterator, error) {
+    if mm.reverse == nil {
+        return nil, NoReverseIndex
+    }
+    return mm.iterator(mm.reverse, value)
+}
+
+func (mm *MultiMap) Contains(key Key, value Key) (bool, error) {
+    s, err := mm.forward.FindSet(key)
+    if err != nil {
+        return false, err
+    }
+    return s.Contains(value)
+}
+
+// Number of values under `key`.
+func (mm *MultiMap) Count(key Key) (int, error) {
+    it, err := mm.Get(key)
+    if err != nil {
+        return 0, err
+    }
+    n := 0
+    for ; it.IsValid(); it.Next() {
+        n++
+    }
+    return n, nil
+}
+
+// Iterate over every key that has at least one value.
+func (mm *MultiMap) Keys() (BundleIterator, error) {
+    return mm.forward.Iterator()
+}
+
+func (mm *MultiMap) iterator(index *Bundle, key Key) (BundleIterator, error) {
+    s, err := index.FindSet(key)
+    if err != nil {
+        return nil, err
+    }
+    it, err := s.Iterator()
+    if err != nil {
+        return nil, err
+    }
+    it.Seek(MinKey)
+    return it, nil
+}
+
+func (mm *MultiMap) collect(index *Bundle, key Key) ([]Key, error) {
+    it, err := mm.iterator(index, key)
+    if err != nil {
+        return nil, err
+    }
+    keys := []Key{}
+    for ; it.IsValid(); it.Next() {
+        keys = append(keys, it.Key())
+    }
+    return keys, nil
+}
+
+type RootMultiMap struct {
+    *MultiMap
+    root *Root
+}
+func multiMapFromRoot(root *Root, opts MultiMapOptions) (*RootMultiMap, error) {
+    m, err := multiMapFromBundle(root.Bundle, opts)
+    return &RootMultiMap{m, root}, err
+}
+func (m *RootMultiMap) Commit() error {
+    return m.root.Commit()
+}
+func (m *RootMultiMap) Close() {
+    m.root.Close()
+}
@@ -0,0 +1,162 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func collectKeys(it BundleIterator) []Key {
+    keys := []Key{}
+    for ; it.IsValid(); it.Next() {
+        keys = append(keys, it.Key())
+    }
+    return keys
+}
+
+func TestMultiMap(t *testing.T) {
+    num := MAX_SHARD_SET_SIZE * 3
+    opts := MultiMapOptions{Reverse: true}
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootMultiMap(Key(0), opts, txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            for x := 0; x < num; x++ {
+                exists, err := mm.Add(Key(1), Key(x))
+                require.NoError(t, err)
+                require.False(t, exists)
+                mm.Add(Key(x % 2 + 2), Key(x))
+            }
+            exists, err := mm.Add(Key(1), Key(0))
+            require.NoError(t, err)
+            require.True(t, exists)
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootMultiMap(Key(0), opts, txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            count, err := mm.Count(Key(1))
+            require.NoError(t, err)
+            require.Equal(t, num, count)
+            count, err = mm.Count(Key(2))
+            require.NoError(t, err)
+            require.Equal(t, num / 2, count)
+
+            it, err := mm.GetReverse(Key(5))
+            require.NoError(t, err)
+            require.Equal(t, []Key{Key(1), Key(3)}, collectKeys(it))
+
+            exists, err := mm.Remove(Key(3), Key(5))
+            require.NoError(t, err)
+            require.True(t, exists)
+            exists, err = mm.Remove(Key(3), Key(5))
+            require.NoError(t, err)
+            require.False(t, exists)
+            it, _ = mm.GetReverse(Key(5))
+            require.Equal(t, []Key{Key(1)}, collectKeys(it))
+
+            // Emptying a key removes its Set.
+            for x := 1; x < num; x += 2 {
+                mm.Remove(Key(3), Key(x))
+            }
+            it, _ = mm.Keys()
+            require.Equal(t, []Key{Key(1), Key(2)}, collectKeys(it))
+
+            removed, err := mm.RemoveKey(Key(1))
+            require.NoError(t, err)
+            require.Equal(t, num, removed)
+            it, _ = mm.GetReverse(Key(1))
+            require.Equal(t, []Key{}, collectKeys(it))
+            it, _ = mm.GetReverse(Key(2))
+            require.Equal(t, []Key{Key(2)}, collectKeys(it))
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootMultiMap(Key(0), MultiMapOptions{}, txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            it, _ := mm.Keys()
+            require.Equal(t, []Key{Key(2)}, collectKeys(it))
+            it, _ = mm.Get(Key(2))
+            require.Equal(t, num / 2, len(collectKeys(it)))
+            exists, err := mm.Contains(Key(2), Key(4))
+            require.NoError(t, err)
+            require.True(t, exists)
+
+            // The reverse index is stored with the MultiMap.
+            it, err = mm.GetReverse(Key(4))
+            require.NoError(t, err)
+            require.Equal(t, []Key{Key(2)}, collectKeys(it))
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestMultiMapReverseStored(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootMultiMap(Key(0), MultiMapOptions{}, txn)
+            require.NoError(t, err)
+            defer mm.Close()
+            mm.Add(Key(1), Key(10))
+            mm.Add(Key(2), Key(10))
+            _, err = mm.GetReverse(Key(10))
+            require.Equal(t, NoReverseIndex, err)
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+
+        // Turning the index on builds it from the existing entries.
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootMultiMap(Key(0), MultiMapOptions{Reverse: true}, txn)
+            require.NoError(t, err)
+            defer mm.Close()
+            it, err := mm.GetReverse(Key(10))
+            require.NoError(t, err)
+            require.Equal(t, []Key{Key(1), Key(2)}, collectKeys(it))
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+
+        // A writer that leaves the option out still maintains the index.
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootMultiMap(Key(0), MultiMapOptions{}, txn)
+            require.NoError(t, err)
+            defer mm.Close()
+            mm.Add(Key(3), Key(10))
+            mm.Remove(Key(1), Key(10))
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootMultiMap(Key(0), MultiMapOptions{}, txn)
+            require.NoError(t, err)
+            defer mm.Close()
+            it, err := mm.GetReverse(Key(10))
+            require.NoError(t, err)
+            require.Equal(t, []Key{Key(2), Key(3)}, collectKeys(it))
+
+            root, coll, err := OpenAny(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+            _, ok := coll.(*MultiMap)
+            require.True(t, ok)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
@@ -0,0 +1,287 @@
+package bundledb
+
+import (
+    "bytes"
+    "encoding/binary"
+    "math"
+)
+
+const (
+    headerBloom = byte(80)
+    headerBloomPointer = byte(81)
+    // Filters bigger than this are moved out of their parent into their own row. Values in a Map are limited to 64KB.
+    MAX_EMBEDDED_BLOOM_BYTES = 16 * 1024
+    // Each stage of a scalable filter holds twice as many keys as the last with half the false positive rate.
+    bloomGrowth = 2
+    bloomTightening = 0.5
+    bloomStageHeaderBytes = 1 + 4 + 4 + 4
+)
+
+var (
+    DefaultBloomOptions = BloomOptions{Capacity: 1000, FalsePositiveRate: 0.01}
+)
+
+// Options used when a Bloom filter is first created. Once written, a filter keeps the options it was created with.
+type BloomOptions struct {
+    // Number of keys the filter can hold before the false positive rate rises above FalsePositiveRate.
+    Capacity int
+    FalsePositiveRate float64
+    // Add a new, larger stage instead of degrading once Capacity keys have been added.
+    Scalable bool
+}
+
+type bloomType struct {
+    opts BloomOptions
+}
+// A Decoder for Bloom filters which will be created with `opts`.
+func NewBloomDecoder(opts BloomOptions) Decoder { return bloomType{opts} }
+func (x bloomType) Type() CollectionType { return TypeBloom }
+func (x bloomType) Table() byte { return tableBloom }
+func (x bloomType) NewPrimitive() Primitive { return newPrimBloom(x.opts) }
+func (x bloomType) IsPointer(b []byte) bool { return len(b) > 0 && b[0] == headerBloomPointer }
+func (x bloomType) IsPrimitive(b []byte) bool {
+    return b == nil || len(b) == 0 || b[0] == headerBloom
+}
+
+type bloomStage struct {
+    hashes uint8
+    capacity uint32
+    count uint32
+    bits []byte
+}
+
+func newBloomStage(capacity int, fpRate float64) bloomStage {
+    if capacity < 1 {
+        capacity = 1
+    }
+    if fpRate <= 0 || fpRate >= 1 {
+        fpRate = DefaultBloomOptions.FalsePositiveRate
+    }
+    nbits := math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+    hashes := math.Round(nbits / float64(capacity) * math.Ln2)
+    if hashes < 1 {
+        hashes = 1
+    }
+    return bloomStage{
+        hashes: uint8(hashes),
+        capacity: uint32(capacity),
+        bits: make([]byte, (int(nbits) + 7) / 8),
+    }
+}
+
+func bloomHashes(key Key) (uint64, uint64) {
+    return hllHash(key), hllHash(^key) | 1
+}
+
+func (stage *bloomStage) positions(key Key, f func(uint64) bool) bool {
+    h1, h2 := bloomHashes(key)
+    nbits := uint64(len(stage.bits)) * 8
+    for ii := uint64(0); ii < uint64(stage.hashes); ii++ {
+        if !f((h1 + ii * h2) % nbits) {
+            return false
+        }
+    }
+    return true
+}
+
+func (stage *bloomStage) mayContain(key Key) bool {
+    return stage.positions(key, func(pos uint64) bool {
+        return stage.bits[pos / 8] & (1 << (pos % 8)) != 0
+    })
+}
+
+func (stage *bloomStage) add(key Key) {
+    stage.positions(key, func(pos uint64) bool {
+        stage.bits[pos / 8] |= 1 << (pos % 8)
+        return true
+    })
+    stage.count++
+}
+
+// primBloom answers whether a Key may have been written to it. Reads never give false negatives.
+type primBloom struct {
+    opts BloomOptions
+    stages []bloomStage
+    dirty bool
+}
+
+func newPrimBloom(opts BloomOptions) *primBloom {
+    return &primBloom{opts: opts}
+}
+// A large filter is kept whole in a single shard.
+func (pbloom *primBloom) MakePointer(shardId []byte) []byte {
+    return append([]byte{headerBloomPointer}, shardId...)
+}
+func (pbloom *primBloom) Reset() {
+    pbloom.stages = nil
+}
+func (pbloom *primBloom) Keys() []Key { return []Key{} }
+func (pbloom *primBloom) CanDelete() bool { return false }
+func (pbloom *primBloom) IsDirty() bool { return pbloom.dirty }
+func (pbloom *primBloom) CanPopEmbed() bool { return pbloom.Size() > MAX_EMBEDDED_BLOOM_BYTES }
+func (pbloom *primBloom) CanSplitShard() bool { return false }
+func (pbloom *primBloom) Max() Key { return MaxKey }
+func (pbloom *primBloom) Split() Primitive { return nil }
+func (pbloom *primBloom) InRange(toCompare Key) bool { return true }
+func (pbloom *primBloom) Size() int {
+    tot := 1 + 1 + 8 + 1
+    for _, stage := range pbloom.stages {
+        tot += bloomStageHeaderBytes + len(stage.bits)
+    }
+    return tot
+}
+func (pbloom *primBloom) Serialize(w *bytes.Buffer) int {
+    w.WriteByte(headerBloom)
+    w.WriteByte(boolToByte(pbloom.opts.Scalable))
+    num := make([]byte, 8)
+    binary.LittleEndian.PutUint64(num, math.Float64bits(pbloom.opts.FalsePositiveRate))
+    w.Write(num)
+    w.WriteByte(byte(len(pbloom.stages)))
+    for _, stage := range pbloom.stages {
+        w.WriteByte(stage.hashes)
+        binary.LittleEndian.PutUint32(num, stage.capacity)
+        w.Write(num[:4])
+        binary.LittleEndian.PutUint32(num, stage.count)
+        w.Write(num[:4])
+        binary.LittleEndian.PutUint32(num, uint32(len(stage.bits)))
+        w.Write(num[:4])
+        w.Write(stage.bits)
+    }
+    return pbloom.Size()
+}
+func (pbloom *primBloom) Bytes() []byte {
+    var b bytes.Buffer
+    pbloom.Serialize(&b)
+    return b.Bytes()
+}
+func (pbloom *primBloom) FromBytesReadOnly(stream []byte) error {
+    pbloom.Reset()
+    if len(stream) == 0 {
+        return nil
+    }
+    if len(stream) < 11 {
+        return InvalidHeader
+    }
+    pbloom.opts.Scalable = byteToBool(stream[1])
+    pbloom.opts.FalsePositiveRate = math.Float64frombits(binary.LittleEndian.Uint64(stream[2:10]))
+    n := int(stream[10])
+    offset := 11
+    pbloom.stages = make([]bloomStage, n)
+    for ii := 0; ii < n; ii++ {
+        if len(stream) < offset + bloomStageHeaderBytes {
+            return InvalidHeader
+        }
+        stage := bloomStage{
+            hashes: stream[offset],
+            capacity: binary.LittleEndian.Uint32(stream[offset + 1:]),
+            count: binary.LittleEndian.Uint32(stream[offset + 5:]),
+        }
+        size := int(binary.LittleEndian.Uint32(stream[offset + 9:]))
+        offset += bloomStageHeaderBytes
+        if len(stream) < offset + size {
+            return InvalidHeader
+        }
+        stage.bits = stream[offset:offset + size]
+        offset += size
+        pbloom.stages[ii] = stage
+    }
+    pbloom.opts.Capacity = 0
+    if n > 0 {
+        pbloom.opts.Capacity = int(pbloom.stages[0].capacity)
+    }
+    return nil
+}
+func (pbloom *primBloom) FromBytesWritable(stream []byte) error {
+    err := pbloom.FromBytesReadOnly(stream)
+    if err != nil {
+        return err
+    }
+    for ii := range pbloom.stages {
+        pbloom.stages[ii].bits = append([]byte{}, pbloom.stages[ii].bits...)
+    }
+    return nil
+}
+
+func (pbloom *primBloom) mayContain(key Key) bool {
+    for ii := range pbloom.stages {
+        if pbloom.stages[ii].mayContain(key) {
+            return true
+        }
+    }
+    return false
+}
+// Reports whether `key` may have been written. Never a false negative.
+func (pbloom *primBloom) Read(key Key) (Value, bool) {
+    return nil, pbloom.mayContain(key)
+}
+// Add `key`, returning whether it may have already been present.
+func (pbloom *primBloom) Write(key Key, _ Value) bool {
+    if pbloom.mayContain(key) {
+        return true
+    }
+    n := len(pbloom.stages)
+    switch {
+    case n == 0:
+        pbloom.stages = append(pbloom.stages, newBloomStage(pbloom.opts.Capacity, pbloom.opts.FalsePositiveRate))
+    case pbloom.opts.Scalable && pbloom.stages[n - 1].count >= pbloom.stages[n - 1].capacity && n < 255:
+        last := pbloom.stages[n - 1]
+        fpRate := pbloom.opts.FalsePositiveRate * math.Pow(bloomTightening, float64(n))
+        pbloom.stages = append(pbloom.stages, newBloomStage(int(last.capacity) * bloomGrowth, fpRate))
+    }
+    pbloom.stages[len(pbloom.stages) - 1].add(key)
+    pbloom.dirty = true
+    return false
+}
+// Keys can't be removed from a Bloom filter.
+func (pbloom *primBloom) Delete(key Key) bool {
+    return false
+}
+
+type BloomFilter struct {
+    bund *Bundle
+}
+
+func bloomFilterFromBundle(bund *Bundle) (*BloomFilter, error) {
+    return &BloomFilter{bund}, nil
+}
+// Add `keys`, returning true if every key may have already been present.
+func (f *BloomFilter) Add(keys ...Key) (bool, error) {
+    all := true
+    for _, key := range keys {
+        exists, err := f.bund.Write(key, nil)
+        if err != nil {
+            return false, err
+        }
+        all = all && exists
+    }
+    return all, nil
+}
+// False means `key` was never added. True means it probably was.
+func (f *BloomFilter) MayContain(key Key) (bool, error) {
+    _, exists, err := f.bund.Read(key)
+    return exists, err
+}
+// Add every key from `it`. Useful to build a filter for a Set that already has members.
+func (f *BloomFilter) AddIterator(it BundleIterator) error {
+    for it.Seek(MinKey); it.IsValid(); it.Next() {
+        if _, err := f.Add(it.Key()); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+type RootBloomFilter struct {
+    *BloomFilter
+    root *Root
+}
+func bloomFilterFromRoot(root *Root) (*RootBloomFilter, error) {
+    m, err := bloomFilterFromBundle(root.Bundle)
+    return &RootBloomFilter{m, root}, err
+}
+func (m *RootBloomFilter) Commit() error {
+    return m.root.Commit()
+}
+func (m *RootBloomFilter) Close() {
+    m.root.Close()
+}
@@ -0,0 +1,260 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func countFalsePositives(t *testing.T, f *BloomFilter, from, to int) int {
+    fp := 0
+    for x := from; x < to; x++ {
+        maybe, err := f.MayContain(Key(x))
+        require.NoError(t, err)
+        if maybe {
+            fp++
+        }
+    }
+    return fp
+}
+
+func TestBloomFilter(t *testing.T) {
+    opts := BloomOptions{Capacity: 2000, FalsePositiveRate: 0.01}
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            f, err := GetRootBloomFilter(Key(0), opts, txn)
+            require.NoError(t, err)
+            defer f.Close()
+
+            for x := 0; x < opts.Capacity; x++ {
+                _, err := f.Add(Key(x))
+                require.NoError(t, err)
+            }
+            exists, err := f.Add(Key(0))
+            require.NoError(t, err)
+            require.True(t, exists)
+            return f.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            // Stored options win over the ones passed in.
+            f, err := GetRootBloomFilter(Key(0), DefaultBloomOptions, txn)
+            require.NoError(t, err)
+            defer f.Close()
+
+            require.Equal(t, opts.Capacity, countFalsePositives(t, f.BloomFilter, 0, opts.Capacity))
+            fp := countFalsePositives(t, f.BloomFilter, opts.Capacity, opts.Capacity * 11)
+            require.True(t, fp < opts.Capacity * 10 / 50, "false positives: %d", fp)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestScalableBloomFilter(t *testing.T) {
+    opts := BloomOptions{Capacity: 100, FalsePositiveRate: 0.01, Scalable: true}
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            f, err := root.FindBloomFilter(opts, Key(1))
+            require.NoError(t, err)
+            for x := 0; x < 1000; x++ {
+                f.Add(Key(x))
+            }
+            prim, _ := f.bund.Primitive(MinKey)
+            require.True(t, len(prim.(*primBloom).stages) > 1)
+
+            require.Equal(t, 1000, countFalsePositives(t, f, 0, 1000))
+            fp := countFalsePositives(t, f, 1000, 11000)
+            require.True(t, fp < 10000 / 50, "false positives: %d", fp)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestLargeNestedBloomFilter(t *testing.T) {
+    opts := BloomOptions{Capacity: 100000, FalsePositiveRate: 0.01}
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            f, err := root.FindBloomFilter(opts, Key(1))
+            require.NoError(t, err)
+            for x := 0; x < 1000; x++ {
+                _, err = f.Add(Key(x))
+                require.NoError(t, err)
+            }
+            m, err := root.FindMap(Key(2))
+            require.NoError(t, err)
+            _, err = m.Insert(Key(1), []byte("sibling"))
+            require.NoError(t, err)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        // Reopen and add more so the filter is rewritten from its own row.
+        for ii := 0; ii < 2; ii++ {
+            err = db.Update([]byte("test"), func(txn *store.Txn) error {
+                root, err := GetRootBundle(Key(0), txn)
+                require.NoError(t, err)
+                defer root.Close()
+
+                f, err := root.FindBloomFilter(opts, Key(1))
+                require.NoError(t, err)
+                require.Equal(t, 1000 + ii, countFalsePositives(t, f, 0, 1000 + ii))
+                _, err = f.Add(Key(1000 + ii))
+                require.NoError(t, err)
+
+                m, err := root.FindMap(Key(2))
+                require.NoError(t, err)
+                val, _, err := m.Lookup(Key(1))
+                require.NoError(t, err)
+                require.Equal(t, []byte("sibling"), val)
+                return root.Commit()
+            })
+            require.NoError(t, err)
+        }
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+            exists, err := root.DeleteChild(Key(1))
+            require.NoError(t, err)
+            require.True(t, exists)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            it := txn.NewIterator(&store.IteratorOptions{Prefix: []byte{tableBloom}, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), RangeType: store.RangeClose, Count: -1})
+            defer it.Close()
+            it.Start()
+            require.False(t, it.Valid())
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestSetWithBloom(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            s, _ := root.FindSet(Key(1))
+            s.Add(Key(1))
+
+            _, exists, err := s.Bloom()
+            require.NoError(t, err)
+            require.False(t, exists)
+
+            f, err := s.EnableBloom(DefaultBloomOptions)
+            require.NoError(t, err)
+            // The filter is built from the existing members.
+            maybe, _ := f.MayContain(Key(1))
+            require.True(t, maybe)
+            exists, _ = s.Contains(Key(1))
+            require.True(t, exists)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        // A new handle keeps the filter up to date without being told about it.
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            s, _ := root.FindSet(Key(1))
+            for x := 10; x < MAX_SHARD_SET_SIZE * 4; x++ {
+                s.Add(Key(x))
+            }
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            s, _ := root.FindSet(Key(1))
+            f, exists, err := s.Bloom()
+            require.NoError(t, err)
+            require.True(t, exists)
+            for x := 10; x < MAX_SHARD_SET_SIZE * 4; x++ {
+                maybe, _ := f.MayContain(Key(x))
+                require.True(t, maybe)
+                exists, _ = s.Contains(Key(x))
+                require.True(t, exists)
+            }
+            exists, _ = s.Contains(Key(5))
+            require.False(t, exists)
+            return nil
+        })
+        require.NoError(t, err)
+
+        // Enabling the filter on a Set that is already sharded.
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            s, _ := root.FindSet(Key(2))
+            for x := 0; x < MAX_SHARD_SET_SIZE * 4; x++ {
+                s.Add(Key(x))
+            }
+            return root.Commit()
+        })
+        require.NoError(t, err)
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            s, _ := root.FindSet(Key(2))
+            _, err := s.EnableBloom(DefaultBloomOptions)
+            require.NoError(t, err)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            s, _ := root.FindSet(Key(2))
+            s.Add(Key(MAX_SHARD_SET_SIZE * 10))
+            f, exists, err := s.Bloom()
+            require.NoError(t, err)
+            require.True(t, exists)
+            for _, x := range []int{0, MAX_SHARD_SET_SIZE * 3, MAX_SHARD_SET_SIZE * 10} {
+                maybe, _ := f.MayContain(Key(x))
+                require.True(t, maybe)
+            }
+
+            exists, err = root.DeleteChild(Key(2))
+            require.NoError(t, err)
+            require.True(t, exists)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            _, err := txn.Get(setBloomKey([]Key{Key(0), Key(2)}))
+            require.Equal(t, store.ErrKeyNotFound, err)
+            _, err = txn.Get(setBloomKey([]Key{Key(0), Key(1)}))
+            require.NoError(t, err)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
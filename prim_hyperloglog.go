@@ -0,0 +1,286 @@
+package bundledb
+
+import (
+    "bytes"
+    "encoding/binary"
+    "math"
+    "math/bits"
+    "sort"
+)
+
+const (
+    HLL_PRECISION = 12
+    HLL_REGISTERS = 1 << HLL_PRECISION
+    // Sparse HyperLogLogs switch to a dense register array once the sparse encoding would be larger than this.
+    HLL_MAX_SPARSE_BYTES = HLL_REGISTERS / 4
+    hllSparseEntryBytes = 3
+    headerHLLSparse = byte(70)
+    headerHLLDense = byte(71)
+)
+
+type hllType struct{}
+func (x hllType) Type() CollectionType { return TypeHyperLogLog }
+func (x hllType) Table() byte { panic("No Table for table") }
+func (x hllType) NewPrimitive() Primitive { return &primHLL{} }
+func (x hllType) IsPointer(b []byte) bool { return false }
+func (x hllType) IsPrimitive(b []byte) bool {
+    return b == nil || len(b) == 0 || b[0] == headerHLLSparse || b[0] == headerHLLDense
+}
+
+// A register update in the sparse encoding.
+type hllEntry struct {
+    index uint16
+    rank uint8
+}
+
+// primHLL estimates the number of distinct Keys written to it. Small HyperLogLogs store only the registers that are set
+// so they stay tiny when embedded. Reads always report the key as missing since membership isn't tracked.
+type primHLL struct {
+    sparse []hllEntry
+    dense []byte
+    dirty bool
+}
+
+func newPrimHLL() *primHLL {
+    return &primHLL{}
+}
+func hllHash(key Key) uint64 {
+    // fmix64 from MurmurHash3
+    h := uint64(key)
+    h ^= h >> 33
+    h *= 0xff51afd7ed558ccd
+    h ^= h >> 33
+    h *= 0xc4ceb9fe1a85ec53
+    h ^= h >> 33
+    return h
+}
+func hllRegister(key Key) (uint16, uint8) {
+    h := hllHash(key)
+    index := uint16(h >> (64 - HLL_PRECISION))
+    rest := h << HLL_PRECISION | 1 << (HLL_PRECISION - 1)
+    return index, uint8(bits.LeadingZeros64(rest) + 1)
+}
+func (phll *primHLL) MakePointer(shardId []byte) []byte {
+    panic("No Pointer for Node")
+}
+func (phll *primHLL) Reset() {
+    phll.sparse = nil
+    phll.dense = nil
+}
+func (phll *primHLL) Keys() []Key { return []Key{} }
+func (phll *primHLL) CanDelete() bool { return false }
+func (phll *primHLL) IsDirty() bool { return phll.dirty }
+func (phll *primHLL) CanPopEmbed() bool { return false }
+func (phll *primHLL) CanSplitShard() bool { return false }
+func (phll *primHLL) Max() Key { return MaxKey }
+func (phll *primHLL) Split() Primitive { return nil }
+func (phll *primHLL) InRange(toCompare Key) bool { return true }
+func (phll *primHLL) Size() int {
+    if phll.dense != nil {
+        return 1 + HLL_REGISTERS
+    }
+    return 1 + hllSparseEntryBytes * len(phll.sparse)
+}
+func (phll *primHLL) Serialize(w *bytes.Buffer) int {
+    if phll.dense != nil {
+        w.WriteByte(headerHLLDense)
+        w.Write(phll.dense)
+        return 1 + HLL_REGISTERS
+    }
+    w.WriteByte(headerHLLSparse)
+    entry := make([]byte, hllSparseEntryBytes)
+    for _, e := range phll.sparse {
+        binary.LittleEndian.PutUint16(entry, e.index)
+        entry[2] = e.rank
+        w.Write(entry)
+    }
+    return 1 + hllSparseEntryBytes * len(phll.sparse)
+}
+func (phll *primHLL) Bytes() []byte {
+    var b bytes.Buffer
+    phll.Serialize(&b)
+    return b.Bytes()
+}
+func (phll *primHLL) FromBytesReadOnly(stream []byte) error {
+    phll.Reset()
+    if len(stream) == 0 {
+        return nil
+    }
+    if stream[0] == headerHLLDense {
+        if len(stream) != 1 + HLL_REGISTERS {
+            return InvalidHeader
+        }
+        phll.dense = stream[1:]
+        return nil
+    }
+    body := stream[1:]
+    if len(body) % hllSparseEntryBytes != 0 {
+        return InvalidHeader
+    }
+    phll.sparse = make([]hllEntry, len(body) / hllSparseEntryBytes)
+    for ii := range phll.sparse {
+        offset := ii * hllSparseEntryBytes
+        phll.sparse[ii] = hllEntry{binary.LittleEndian.Uint16(body[offset:]), body[offset + 2]}
+    }
+    return nil
+}
+func (phll *primHLL) FromBytesWritable(stream []byte) error {
+    err := phll.FromBytesReadOnly(stream)
+    if err != nil {
+        return err
+    }
+    if phll.dense != nil {
+        phll.dense = append([]byte{}, phll.dense...)
+    }
+    return nil
+}
+
+func (phll *primHLL) Read(key Key) (Value, bool) {
+    return nil, false
+}
+// Add `key` to the estimate. Returns false if this changed a register, true if `key` may have been seen before.
+func (phll *primHLL) Write(key Key, _ Value) bool {
+    index, rank := hllRegister(key)
+    return !phll.setRegister(index, rank)
+}
+// HyperLogLogs can't forget keys.
+func (phll *primHLL) Delete(key Key) bool {
+    return false
+}
+
+// Raise register `index` to `rank`, returning true if it changed.
+func (phll *primHLL) setRegister(index uint16, rank uint8) bool {
+    if phll.dense != nil {
+        if phll.dense[index] >= rank {
+            return false
+        }
+        phll.dense[index] = rank
+        phll.dirty = true
+        return true
+    }
+    ix := sort.Search(len(phll.sparse), func(i int) bool { return phll.sparse[i].index >= index })
+    if ix < len(phll.sparse) && phll.sparse[ix].index == index {
+        if phll.sparse[ix].rank >= rank {
+            return false
+        }
+        phll.sparse[ix].rank = rank
+        phll.dirty = true
+        return true
+    }
+    phll.sparse = append(phll.sparse, hllEntry{})
+    copy(phll.sparse[ix+1:], phll.sparse[ix:])
+    phll.sparse[ix] = hllEntry{index, rank}
+    phll.dirty = true
+    if len(phll.sparse) * hllSparseEntryBytes > HLL_MAX_SPARSE_BYTES {
+        phll.dense = phll.registers()
+        phll.sparse = nil
+    }
+    return true
+}
+
+func (phll *primHLL) registers() []byte {
+    if phll.dense != nil {
+        return phll.dense
+    }
+    regs := make([]byte, HLL_REGISTERS)
+    for _, e := range phll.sparse {
+        regs[e.index] = e.rank
+    }
+    return regs
+}
+
+func (phll *primHLL) estimate() uint64 {
+    m := float64(HLL_REGISTERS)
+    sum := 0.0
+    zeros := 0
+    for _, r := range phll.registers() {
+        sum += 1 / float64(uint64(1) << r)
+        if r == 0 {
+            zeros++
+        }
+    }
+    alpha := 0.7213 / (1 + 1.079 / m)
+    est := alpha * m * m / sum
+    if est <= 2.5 * m && zeros > 0 {
+        // Linear counting is more accurate for small cardinalities.
+        est = m * math.Log(m / float64(zeros))
+    }
+    return uint64(est + 0.5)
+}
+
+type HyperLogLog struct {
+    bund *Bundle
+}
+
+func hyperLogLogFromBundle(bund *Bundle) (*HyperLogLog, error) {
+    return &HyperLogLog{bund}, nil
+}
+func (h *HyperLogLog) prim() (*primHLL, error) {
+    prim, err := h.bund.Primitive(MinKey)
+    if err != nil {
+        return nil, err
+    }
+    return prim.(*primHLL), nil
+}
+// Add `keys` to the estimate. Returns true if the estimate may have changed.
+func (h *HyperLogLog) PFAdd(keys ...Key) (bool, error) {
+    prim, err := h.prim()
+    if err != nil {
+        return false, err
+    }
+    changed := false
+    for _, key := range keys {
+        if !prim.Write(key, nil) {
+            changed = true
+        }
+    }
+    return changed, nil
+}
+// Estimated number of distinct keys added.
+func (h *HyperLogLog) PFCount() (uint64, error) {
+    prim, err := h.prim()
+    if err != nil {
+        return 0, err
+    }
+    return prim.estimate(), nil
+}
+// Merge `others` into this HyperLogLog so it estimates the union of all of them.
+func (h *HyperLogLog) PFMerge(others ...*HyperLogLog) error {
+    prim, err := h.prim()
+    if err != nil {
+        return err
+    }
+    for _, other := range others {
+        oprim, err := other.prim()
+        if err != nil {
+            return err
+        }
+        if oprim.dense == nil {
+            for _, e := range oprim.sparse {
+                prim.setRegister(e.index, e.rank)
+            }
+            continue
+        }
+        for index, rank := range oprim.dense {
+            if rank > 0 {
+                prim.setRegister(uint16(index), rank)
+            }
+        }
+    }
+    return nil
+}
+
+type RootHyperLogLog struct {
+    *HyperLogLog
+    root *Root
+}
+func hyperLogLogFromRoot(root *Root) (*RootHyperLogLog, error) {
+    m, err := hyperLogLogFromBundle(root.Bundle)
+    return &RootHyperLogLog{m, root}, err
+}
+func (m *RootHyperLogLog) Commit() error {
+    return m.root.Commit()
+}
+func (m *RootHyperLogLog) Close() {
+    m.root.Close()
+}
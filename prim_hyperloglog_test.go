@@ -0,0 +1,114 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func requireEstimate(t *testing.T, h *HyperLogLog, expected int) {
+    count, err := h.PFCount()
+    require.NoError(t, err)
+    // 3 standard errors for 4096 registers is about 5%
+    require.InDelta(t, float64(expected), float64(count), float64(expected) * 0.05 + 1)
+}
+
+func TestHyperLogLogSparse(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, _ := GetRootBundle(Key(0), txn)
+            defer mm.Close()
+
+            h, err := mm.FindHyperLogLog(Key(1), Key(2))
+            require.NoError(t, err)
+            changed, err := h.PFAdd(Key(1), Key(2), Key(3))
+            require.NoError(t, err)
+            require.True(t, changed)
+            changed, err = h.PFAdd(Key(1))
+            require.NoError(t, err)
+            require.False(t, changed)
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            mm, _ := GetRootBundle(Key(0), txn)
+            defer mm.Close()
+
+            h, err := mm.FindHyperLogLog(Key(1), Key(2))
+            require.NoError(t, err)
+            prim, _ := h.prim()
+            require.Nil(t, prim.dense)
+            require.Equal(t, 1 + 3 * hllSparseEntryBytes, prim.Size())
+            count, err := h.PFCount()
+            require.NoError(t, err)
+            require.Equal(t, uint64(3), count)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestHyperLogLogDense(t *testing.T) {
+    num := 50000
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            h, _ := GetRootHyperLogLog(Key(0), txn)
+            defer h.Close()
+            h2, _ := GetRootHyperLogLog(Key(1), txn)
+            defer h2.Close()
+
+            for x := 0; x < num; x++ {
+                h.PFAdd(Key(x))
+                h2.PFAdd(Key(x + num / 2))
+            }
+            prim, _ := h.prim()
+            require.NotNil(t, prim.dense)
+            requireEstimate(t, h.HyperLogLog, num)
+
+            require.NoError(t, h.PFMerge(h2.HyperLogLog))
+            requireEstimate(t, h.HyperLogLog, num + num / 2)
+            if err := h.Commit(); err != nil {
+                return err
+            }
+            return h2.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            h, _ := GetRootHyperLogLog(Key(0), txn)
+            defer h.Close()
+            requireEstimate(t, h.HyperLogLog, num + num / 2)
+
+            _, err := GetRootSet(Key(0), txn)
+            requireTypeMismatch(t, err, TypeSet, TypeHyperLogLog)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestHyperLogLogMergeSparse(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            dest, _ := root.FindHyperLogLog(Key(0))
+            a, _ := root.FindHyperLogLog(Key(1))
+            b, _ := root.FindHyperLogLog(Key(2))
+            for x := 0; x < 100; x++ {
+                a.PFAdd(Key(x))
+                b.PFAdd(Key(x + 50))
+            }
+            require.NoError(t, dest.PFMerge(a, b))
+            requireEstimate(t, dest, 150)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+    })
+}
@@ -10,6 +10,7 @@ const (
     MaxKey = Key(1<<64 - 1)
     MinKey = Key(0)
     headerUser = byte(0)
+    headerUserExpiring = byte(1)
 )
 
 type Key uint64
@@ -31,6 +32,20 @@ func (v UserVal) Serialize(w *bytes.Buffer) int {
     return 1 + s
 }
 
+// A user value that stops being visible once `expires` (Unix nanoseconds) has passed.
+type expiringVal struct {
+    expires Key
+    val []byte
+}
+func (v expiringVal) Size() int {return 1 + KeyLength + len(v.val)}
+func (v expiringVal) Bytes() []byte {return append(append([]byte{headerUserExpiring}, v.expires.Bytes()...), v.val...)}
+func (v expiringVal) Serialize(w *bytes.Buffer) int {
+    w.WriteByte(headerUserExpiring)
+    w.Write(v.expires.Bytes())
+    s, _ := w.Write(v.val)
+    return 1 + KeyLength + s
+}
+
 type Value interface {
     Size() int
     Bytes() []byte
@@ -14,6 +14,7 @@ const (
 
 
 type listType struct{}
+func (x listType) Type() CollectionType { return TypeList }
 func (x listType) Table() byte { panic("No Table for table") }
 func (x listType) NewPrimitive() Primitive { return &primList{} }
 func (x listType) IsPointer(b []byte) bool { return false }
@@ -142,6 +143,8 @@ type List struct {
     rightKey Key
     bund *Bundle
     mapBund *Bundle
+    // The error that stopped the last Keys or All loop.
+    iterErr error
 }
 
 func listFromBundle(bund *Bundle) (*List, error) {
@@ -166,29 +169,45 @@ func listFromBundle(bund *Bundle) (*List, error) {
 }
 func (d *List) LPeek(index Key) ([]byte, bool, error) {
     if d.rightKey - d.leftKey - 1 >= index {
-        val, r, err := d.mapBund.Read(d.leftKey + index)
-        if val != nil {
-            return val.Bytes()[1:], r, err
-        }
+        return d.read(d.leftKey + index)
     }
     return nil, false, nil
 }
 func (d *List) RPeek(index Key) ([]byte, bool, error) {
     if d.rightKey - d.leftKey - 1 >= index  {
-        val, r, err := d.mapBund.Read(d.rightKey - index - 1)
-        if val != nil {
-            return val.Bytes()[1:], r, err
-        }
+        return d.read(d.rightKey - index - 1)
     }
     return nil, false, nil
 }
-func (d *List) LPop() ([]byte, bool, error) {
-    if d.leftKey < d.rightKey {
-        val, _, err := d.mapBund.Read(d.leftKey)
-        if err != nil {
+func (d *List) read(key Key) ([]byte, bool, error) {
+    val, r, err := d.mapBund.Read(key)
+    if err != nil || val == nil {
+        return nil, r, err
+    }
+    b, err := storedBytes(d.bund.txn, val)
+    return b, r, err
+}
+// Read and delete the item at `key`, dropping the chunks of a blob.
+func (d *List) take(key Key) ([]byte, bool, error) {
+    val, r, err := d.mapBund.Read(key)
+    if err != nil {
+        return nil, false, err
+    }
+    var b []byte
+    if val != nil {
+        if b, err = storedBytes(d.bund.txn, val); err != nil {
             return nil, false, err
         }
-        _, err = d.mapBund.Delete(d.leftKey)
+        if err := dropBlobOf(d.bund.txn, d.path(key), val); err != nil {
+            return nil, false, err
+        }
+    }
+    _, err = d.mapBund.Delete(key)
+    return b, r, err
+}
+func (d *List) LPop() ([]byte, bool, error) {
+    if d.leftKey < d.rightKey {
+        val, _, err := d.take(d.leftKey)
         if err != nil {
             return nil, false, err
         }
@@ -197,53 +216,69 @@ func (d *List) LPop() ([]byte, bool, error) {
         if err != nil {
             return nil, false, err
         }
-        if val != nil {
-            return val.Bytes()[1:], true, nil
-        }
-        return nil, true, nil
+        return val, true, nil
     }
     return nil, false, nil
 }
 func (d *List) RPop() ([]byte, bool, error) {
     if d.leftKey < d.rightKey {
-        val, r, err := d.mapBund.Read(d.rightKey - 1)
+        val, r, err := d.take(d.rightKey - 1)
         if err != nil {
             return nil, false, err
         }
-        _, err = d.mapBund.Delete(d.rightKey - 1)
         d.rightKey--
         _, err = d.bund.Write(ListRight, d.rightKey)
         if err != nil {
             return nil, false, err
         }
-
-        if err != nil {
-            return nil, false, err
-        }
-        if val != nil {
-            return val.Bytes()[1:], r, nil
-        }
-        return nil, r, nil
+        return val, r, nil
     }
     return nil, false, nil
 }
+// Push `val` onto the left. A value over MAX_INLINE_VALUE_BYTES is stored out of line as a blob.
 func (d *List) LPush(val []byte) error {
+    v, err := inlineOrBlob(d.bund.txn, val)
+    if err != nil {
+        return err
+    }
+    return d.lpush(v)
+}
+// Push `val` onto the right. A value over MAX_INLINE_VALUE_BYTES is stored out of line as a blob.
+func (d *List) RPush(val []byte) error {
+    v, err := inlineOrBlob(d.bund.txn, val)
+    if err != nil {
+        return err
+    }
+    return d.rpush(v)
+}
+func (d *List) lpush(val Value) error {
     d.leftKey--
     _, err := d.bund.Write(ListLeft, d.leftKey)
     if err != nil {
         return err
     }
-    _, err = d.mapBund.Write(d.leftKey, UserVal(val))
-    return err
+    return d.write(d.leftKey, val)
 }
-func (d *List) RPush(val []byte) error {
+func (d *List) rpush(val Value) error {
     d.rightKey++
     _, err := d.bund.Write(ListRight, d.rightKey)
     if err != nil {
         return err
     }
-    _, err = d.mapBund.Write(d.rightKey - 1, UserVal(val))
-    return err
+    return d.write(d.rightKey - 1, val)
+}
+// Write the item at `key`, adding a blob to the blob index.
+func (d *List) write(key Key, val Value) error {
+    if _, err := d.mapBund.Write(key, val); err != nil {
+        return err
+    }
+    if ref, ok := val.(blobRef); ok {
+        return indexBlob(d.bund.txn, d.path(key), ref)
+    }
+    return nil
+}
+func (d *List) path(key Key) []Key {
+    return append(append([]Key{}, d.mapBund.rootPath...), key)
 }
 func (d *List) Iterator() (BundleIterator, error) {
     it, err := d.mapBund.Iterator()
@@ -256,6 +291,7 @@ type listIterator struct {
 }
 func (pit *listIterator) Key() Key { return pit.BundleIterator.Key() - pit.leftKey }
 func (pit *listIterator) Seek(item Key) { pit.BundleIterator.Seek(pit.leftKey + item) }
+func (pit *listIterator) Err() error { return IterErr(pit.BundleIterator) }
 
 
 type RootList struct {
@@ -15,15 +15,30 @@ const (
 
 )
 
-type mapType struct{}
+// The header bytes a map primitive is written with. Collections built on a Map, like Bitmap and Stream, have their
+// own so their type can be told apart.
+type mapHeaders struct {
+    prim byte
+    pointer byte
+    dense byte
+}
+
+var mapHeadersMap = mapHeaders{headerMapPrim, headerMapPointer, headerMapDense}
+
+type mapType struct{
+    headers mapHeaders
+    kind CollectionType
+}
+func (x mapType) Type() CollectionType { return x.kind }
 func (x mapType) Table() byte { return tableMap }
-func (x mapType) NewPrimitive() Primitive { return &primMap{} }
-func (x mapType) IsPointer(b []byte) bool { return b[0] == headerMapPointer }
+func (x mapType) NewPrimitive() Primitive { return &primMap{headers: x.headers} }
+func (x mapType) IsPointer(b []byte) bool { return b[0] == x.headers.pointer }
 func (x mapType) IsPrimitive(b []byte) bool {
-    return b == nil || len(b) == 0 || b[0] == headerMapPrim || b[0] == headerMapDense
+    return b == nil || len(b) == 0 || b[0] == x.headers.prim || b[0] == x.headers.dense
 }
 
 type primMap struct {
+    headers mapHeaders
     keys []Key
     values []Value
     openMin bool
@@ -31,7 +46,7 @@ type primMap struct {
 }
 
 func newPrimMap() *primMap {
-    pmap := primMap{}
+    pmap := primMap{headers: mapHeadersMap}
     pmap.keys = make([]Key, 0)
     pmap.values = make([]Value, 0)
     pmap.openMin = true
@@ -48,7 +63,7 @@ func (pmap *primMap) Size() int {
     return tot
 }
 func (pmap *primMap) MakePointer(shardId []byte) []byte {
-    return append([]byte{headerMapPointer}, shardId...)
+    return append([]byte{pmap.headers.pointer}, shardId...)
 }
 func (pmap *primMap) CanDelete() bool {
     return len(pmap.keys) == 0
@@ -85,11 +100,12 @@ func (pmap *primMap) Split() Primitive {
     key_length := len(pmap.keys)
     if key_length > 1 {
         splitOn := key_length / 2
-        newPmap := primMap{}
+        newPmap := primMap{headers: pmap.headers}
 
-        newPmap.keys = pmap.keys[:splitOn]
-        newPmap.values = pmap.values[:splitOn]
+        newPmap.keys = append([]Key(nil), pmap.keys[:splitOn]...)
+        newPmap.values = append([]Value(nil), pmap.values[:splitOn]...)
         newPmap.openMin = pmap.openMin
+        newPmap.dirty = true
 
         pmap.keys = pmap.keys[splitOn:]
         pmap.values = pmap.values[splitOn:]
@@ -107,7 +123,7 @@ func (pmap *primMap) Bytes() []byte {
 func (pmap *primMap) Serialize(bw *bytes.Buffer) int {
     n := len(pmap.keys)
     if n > 0 && int(pmap.Max() - pmap.keys[0]) == n - 1 {
-        bw.WriteByte(headerMapDense)
+        bw.WriteByte(pmap.headers.dense)
         bw.WriteByte(boolToByte(pmap.openMin))
         sz := make([]byte, 2)
         binary.LittleEndian.PutUint16(sz, uint16(n))
@@ -123,7 +139,7 @@ func (pmap *primMap) Serialize(bw *bytes.Buffer) int {
         c, _ := bw.Write(uint16SliceAsByteSlice(sizes))
         return 1 + 1 + a + KeyLength + tot + c
     } else {
-        bw.WriteByte(headerMapPrim)
+        bw.WriteByte(pmap.headers.prim)
         bw.WriteByte(boolToByte(pmap.openMin))
         sz := make([]byte, 2)
         binary.LittleEndian.PutUint16(sz, uint16(n))
@@ -143,7 +159,7 @@ func (pmap *primMap) Serialize(bw *bytes.Buffer) int {
 
 func (pmap *primMap) FromBytesReadOnly(stream []byte) error {
     if stream != nil && len(stream) != 0 {
-        if stream[0] == headerMapDense {
+        if stream[0] == pmap.headers.dense {
             keyN := int(binary.LittleEndian.Uint16(stream[2:4]))
             lengthSize := keyN*2
             offset := 4
@@ -261,23 +277,54 @@ func (pmap *primMap) deleteIndex(ix int) {
 
 type Map struct {
     bund *Bundle
+    // The error that stopped the last Keys or All loop.
+    iterErr error
 }
 func mapFromBundle(bund *Bundle) (*Map, error) {
-    return &Map{bund}, nil
+    return &Map{bund: bund}, nil
 }
+// Lookup the value for `key`. Entries whose TTL has passed are reported as missing and blobs are read in full.
 func (m *Map) Lookup(key Key) ([]byte, bool, error) {
     val, r, err := m.bund.Read(key)
+    if ref, ok := blobRefFromBytes(rawBytes(val)); ok && err == nil {
+        b, err := (&Blob{m.bund.txn, ref}).Bytes()
+        return b, true, err
+    }
     if val != nil {
-        return val.Bytes()[1:], r, err
+        b, ok := userBytes(val.Bytes())
+        return b, r && ok, err
     }
     return nil, r, err
 }
+// Insert `val` under `key`. A value over MAX_INLINE_VALUE_BYTES is stored out of line as a blob.
 func (m *Map) Insert(key Key, val []byte) (bool, error) {
-    return m.bund.Write(key, UserVal(val))
+    if err := m.dropBlob(key); err != nil {
+        return false, err
+    }
+    v, err := inlineOrBlob(m.bund.txn, val)
+    if err != nil {
+        return false, err
+    }
+    if ref, ok := v.(blobRef); ok {
+        return m.writeBlobRef(key, ref)
+    }
+    return m.bund.Write(key, v)
 }
+// Delete `key`, dropping the chunks of a blob stored under it.
 func (m *Map) Delete(key Key) (bool, error) {
+    if err := m.dropBlob(key); err != nil {
+        return false, err
+    }
     return m.bund.Delete(key)
 }
+// Delete every key between `start` and `end` inclusive. Shards inside the range are dropped without being read, and
+// the blobs in the range are found in the blob index.
+func (m *Map) DeleteRange(start, end Key) error {
+    if err := m.dropBlobsIn(start, end); err != nil {
+        return err
+    }
+    return m.bund.DeleteRange(start, end)
+}
 func (m *Map) Iterator() (BundleIterator, error) {
     return m.bund.Iterator()
 }
@@ -296,3 +343,7 @@ func (m *RootMap) Commit() error {
 func (m *RootMap) Close() {
     m.root.Close()
 }
+// The Root the Map lives in, for ExpireSweep.
+func (m *RootMap) Root() *Root {
+    return m.root
+}
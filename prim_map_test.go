@@ -1,6 +1,7 @@
 package bundledb
 
 import (
+    "bytes"
     "fmt"
     "testing"
     "math/rand"
@@ -261,3 +262,189 @@ func insertAndCheckNestedMap(t *testing.T, key_rows [][]Key, valrows [][][]byte)
         require.NoError(t, err)
     })
 }
+
+func TestMapDeleteRange(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            for x := 0; x < MAX_SHARD_MAP_SIZE * 10; x++ {
+                _, err = m.Insert(Key(x), []byte("v"))
+                require.NoError(t, err)
+            }
+            require.NoError(t, m.Commit())
+
+            require.NoError(t, m.DeleteRange(MinKey, Key(MAX_SHARD_MAP_SIZE * 10 - 3)))
+            key, _, exists, err := m.Min()
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, Key(MAX_SHARD_MAP_SIZE * 10 - 2), key)
+            return m.Commit()
+        })
+        require.NoError(t, err)
+    })
+}
+
+// Counts the Map shards read through it, to show which shards an operation decodes.
+type countingDB struct {
+    store.IDB
+    reads *int
+}
+func (db countingDB) View(f func(store.ITxn) error) error {
+    return db.IDB.View(func(txn store.ITxn) error { return f(countingTxn{txn, db.reads}) })
+}
+func (db countingDB) Update(f func(store.ITxn) error) error {
+    return db.IDB.Update(func(txn store.ITxn) error { return f(countingTxn{txn, db.reads}) })
+}
+
+type countingTxn struct {
+    store.ITxn
+    reads *int
+}
+func (txn countingTxn) Get(key []byte) (store.IItem, error) {
+    item, err := txn.ITxn.Get(key)
+    if err != nil {
+        return item, err
+    }
+    return countingItem{item, txn.reads}, nil
+}
+func (txn countingTxn) NewIterator(prefetch int, direction uint8) store.IIterator {
+    return countingIterator{txn.ITxn.NewIterator(prefetch, direction), txn.reads}
+}
+
+type countingIterator struct {
+    store.IIterator
+    reads *int
+}
+func (it countingIterator) Item() store.IItem { return countingItem{it.IIterator.Item(), it.reads} }
+
+type countingItem struct {
+    store.IItem
+    reads *int
+}
+func (item countingItem) count() {
+    if bytes.HasPrefix(item.Key(), append([]byte("test"), tableMap)) {
+        *item.reads++
+    }
+}
+func (item countingItem) Value() ([]byte, error) {
+    item.count()
+    return item.IItem.Value()
+}
+func (item countingItem) ValueCopy(b []byte) ([]byte, error) {
+    item.count()
+    return item.IItem.ValueCopy(b)
+}
+
+func TestMapDeleteRangeSkipsCoveredShards(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 20
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        reads := 0
+        db := store.NewDB(countingDB{idb, &reads})
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            for x := 0; x < num; x++ {
+                _, err = m.Insert(Key(x), []byte("v"))
+                require.NoError(t, err)
+            }
+            for _, x := range []int{0, num / 2, num - 1} {
+                _, err = m.InsertBlob(Key(x), bytes.NewReader([]byte("blob")))
+                require.NoError(t, err)
+            }
+            return m.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            reads = 0
+            require.NoError(t, m.DeleteRange(Key(5), Key(num - 6)))
+            // Only the shards on either end of the range are read.
+            require.True(t, reads <= 2, reads)
+            return m.Commit()
+        })
+        require.NoError(t, err)
+        // The blob in the middle is gone along with its index row.
+        require.Equal(t, 2, tableRows(t, db, tableBlob))
+        require.Equal(t, 2, tableRows(t, db, tableBlobIndex))
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            it, err := m.Iterator()
+            require.NoError(t, err)
+            require.Equal(t, []Key{0, 1, 2, 3, 4, Key(num - 5), Key(num - 4), Key(num - 3), Key(num - 2), Key(num - 1)}, Collect(it, -1))
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestMapSplitDuringTxn(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 100
+    random := rand.New(rand.NewSource(0))
+    keys := random.Perm(num)
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+            m, err := root.FindMap(Key(1))
+            require.NoError(t, err)
+
+            for _, x := range keys {
+                _, err = m.Insert(Key(x), []byte(fmt.Sprintf("%d", x)))
+                require.NoError(t, err)
+            }
+            // No in-memory shard grows past twice the shard size.
+            sb, ok := m.bund.iBundle.(*shardBundle)
+            require.True(t, ok)
+            require.True(t, len(sb.cache) > 1)
+            for _, prim := range sb.cache {
+                require.True(t, len(prim.Keys()) < MAX_SHARD_MAP_SIZE * 2)
+            }
+
+            it, err := m.Iterator()
+            require.NoError(t, err)
+            require.Equal(t, num, len(Collect(it, -1)))
+            key, _, _, err := m.Floor(Key(num + 10))
+            require.NoError(t, err)
+            require.Equal(t, Key(num - 1), key)
+            require.NoError(t, m.DeleteRange(Key(100), Key(num - 101)))
+            key, _, _, err = m.Ceiling(Key(100))
+            require.NoError(t, err)
+            require.Equal(t, Key(num - 100), key)
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+            m, err := root.FindMap(Key(1))
+            require.NoError(t, err)
+
+            it, err := m.Iterator()
+            require.NoError(t, err)
+            found := Collect(it, -1)
+            require.Equal(t, 200, len(found))
+            for _, key := range found {
+                val, exists, err := m.Lookup(key)
+                require.NoError(t, err)
+                require.True(t, exists)
+                require.Equal(t, []byte(fmt.Sprintf("%d", key)), val)
+            }
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
@@ -12,6 +12,7 @@ const (
 )
 
 type setType struct{}
+func (x setType) Type() CollectionType { return TypeSet }
 func (x setType) Table() byte { return tableSet }
 func (x setType) NewPrimitive() Primitive { return &primSet{} }
 func (x setType) IsPointer(b []byte) bool { return b[0] == headerSetPointer }
@@ -22,6 +23,8 @@ func (x setType) IsPrimitive(b []byte) bool {
 type primSet struct {
     keys []Key
     openMin bool
+    // Set on the top primitive of a Set whose Bloom filter is stored next to it.
+    bloom bool
     dirty bool
 }
 
@@ -32,7 +35,11 @@ func newPrimSet() *primSet {
     return &pset
 }
 func (pset *primSet) MakePointer(shardId []byte) []byte {
-    return append([]byte{headerSetPointer}, shardId...)
+    ptr := append([]byte{headerSetPointer}, shardId...)
+    if pset.bloom {
+        ptr = append(ptr, 1)
+    }
+    return ptr
 }
 func (pset *primSet) IsDirty() bool {
     return pset.dirty
@@ -87,8 +94,9 @@ func (pset *primSet) Split() Primitive {
     if key_length > 1 {
         splitOn := key_length / 2
         newPset := primSet{}
-        newPset.keys = pset.keys[:splitOn]
+        newPset.keys = append([]Key(nil), pset.keys[:splitOn]...)
         newPset.openMin = pset.openMin
+        newPset.dirty = true
 
         pset.keys = pset.keys[splitOn:]
 
@@ -130,7 +138,7 @@ func (pset *primSet) Bytes() []byte {
 }
 func (pset *primSet) Serialize(w *bytes.Buffer) int {
     w.WriteByte(headerSetEmbed)
-    w.WriteByte(boolToByte(pset.openMin))
+    w.WriteByte(boolToByte(pset.openMin) | boolToByte(pset.bloom) << 1)
     c, _ := w.Write(propKeySliceAsByteSlice(pset.keys))
     return 2 + c
 }
@@ -138,7 +146,8 @@ func (pset *primSet) Serialize(w *bytes.Buffer) int {
 func (pset *primSet) FromBytesReadOnly(stream []byte) error {
     if len(stream) > 0 {
         pset.keys = byteSliceAsKeySlice(stream[2:])
-        pset.openMin = byteToBool(stream[1])
+        pset.openMin = stream[1] & 1 != 0
+        pset.bloom = stream[1] & 2 != 0
     } else {
         pset.keys = byteSliceAsKeySlice(stream)
         pset.openMin = true
@@ -162,20 +171,85 @@ func (pset *primSet) Reset() {
 
 type Set struct {
     bund *Bundle
+    // The error that stopped the last Keys or All loop.
+    iterErr error
 }
 func setFromBundle(bund *Bundle) (*Set, error) {
-    return &Set{bund}, nil
+    return &Set{bund: bund}, nil
+}
+// Store a Bloom filter with the Set, created with `opts` and filled with the current members. Every Set handle,
+// MultiMap and BulkLoader writing to the Set keeps it up to date, and Contains checks it before loading any shards.
+// Calling it again returns the existing filter.
+func (m *Set) EnableBloom(opts BloomOptions) (*BloomFilter, error) {
+    filter, exists, err := m.Bloom()
+    if err != nil || exists {
+        return filter, err
+    }
+    bloom, err := newBundle(m.bund.txn, m.bund.rootPath, NewBloomDecoder(opts), nil)
+    if err != nil {
+        return nil, err
+    }
+    filter = &BloomFilter{bloom}
+    it, err := m.bund.Iterator()
+    if err != nil {
+        return nil, err
+    }
+    if err := filter.AddIterator(it); err != nil {
+        return nil, err
+    }
+    switch b := m.bund.iBundle.(type) {
+    case *primBundle:
+        pset := b.prim.(*primSet)
+        pset.bloom = true
+        pset.dirty = true
+    case *shardBundle:
+        b.primBytes = append(append([]byte{}, b.primBytes[:9]...), 1)
+        b.popped = true
+    }
+    m.bund.bloom = bloom
+    return filter, nil
+}
+
+// The Bloom filter stored with the Set by EnableBloom.
+func (m *Set) Bloom() (*BloomFilter, bool, error) {
+    bloom, err := m.bund.setBloom()
+    if err != nil || bloom == nil {
+        return nil, false, err
+    }
+    return &BloomFilter{bloom}, true, nil
 }
 func (m *Set) Contains(key Key) (bool, error) {
+    bloom, err := m.bund.setBloom()
+    if err != nil {
+        return false, err
+    }
+    if bloom != nil {
+        if _, maybe, err := bloom.Read(key); err != nil || !maybe {
+            return false, err
+        }
+    }
     _, e, err := m.bund.Read(key)
     return e, err
 }
 func (m *Set) Add(key Key) (bool, error) {
+    bloom, err := m.bund.setBloom()
+    if err != nil {
+        return false, err
+    }
+    if bloom != nil {
+        if _, err := bloom.Write(key, nil); err != nil {
+            return false, err
+        }
+    }
     return m.bund.Write(key, nil)
 }
 func (m *Set) Remove(key Key) (bool, error) {
     return m.bund.Delete(key)
 }
+// Remove every member between `start` and `end` inclusive.
+func (m *Set) RemoveRange(start, end Key) error {
+    return m.bund.DeleteRange(start, end)
+}
 func (d *Set) Iterator() (BundleIterator, error) {
     return d.bund.Iterator()
 }
@@ -294,3 +294,114 @@ func TestprimSetReset(t *testing.T) {
         }
     }
 }
+
+func TestSetRemoveRange(t *testing.T) {
+    num := MAX_SHARD_SET_SIZE * 20
+    countShards := func(txn *store.Txn) int {
+        it := txn.NewIterator(&store.IteratorOptions{Prefix: []byte{tableSet}, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), RangeType: store.RangeClose, Count: -1})
+        defer it.Close()
+        rows := 0
+        for it.Start(); it.Valid(); it.Next() {
+            rows++
+        }
+        return rows
+    }
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            s, err := GetRootSet(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+            for x := 0; x < num; x++ {
+                _, err = s.Add(Key(x))
+                require.NoError(t, err)
+            }
+            return s.Commit()
+        })
+        require.NoError(t, err)
+
+        shards := 0
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            shards = countShards(txn)
+            s, err := GetRootSet(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+
+            require.NoError(t, s.RemoveRange(Key(25), Key(num - 50)))
+            it, err := s.Iterator()
+            require.NoError(t, err)
+            require.Equal(t, 25 + 49, len(Collect(it, -1)))
+            return s.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            require.True(t, countShards(txn) < shards / 2)
+            s, err := GetRootSet(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+
+            it, err := s.Iterator()
+            require.NoError(t, err)
+            keys := Collect(it, -1)
+            require.Equal(t, 25 + 49, len(keys))
+            require.Equal(t, Key(24), keys[24])
+            require.Equal(t, Key(num - 49), keys[25])
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestShardIteratorInterleaved(t *testing.T) {
+    num := MAX_SHARD_SET_SIZE * 6
+    gapStart, gapEnd := num / 2, num / 2 + MAX_SHARD_SET_SIZE * 2
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            s, _ := GetRootSet(Key(0), txn)
+            defer s.Close()
+            for x := 0; x < num; x++ {
+                s.Add(Key(x))
+            }
+            return s.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            s, _ := GetRootSet(Key(0), txn)
+            defer s.Close()
+            // Leave at least one shard empty in the middle of the Set.
+            for x := gapStart; x < gapEnd; x++ {
+                s.Remove(Key(x))
+            }
+
+            expected := []Key{}
+            for x := 0; x < num; x++ {
+                if x < gapStart || x >= gapEnd {
+                    expected = append(expected, Key(x))
+                }
+            }
+            it, err := s.Iterator()
+            require.NoError(t, err)
+            found := []Key{}
+            for it.Seek(MinKey); it.IsValid(); it.Next() {
+                found = append(found, it.Key())
+                // Lookups share the store iterator of the bundle and must not move this one.
+                exists, err := s.Contains(Key(num - 1 - len(found)))
+                require.NoError(t, err)
+                require.Equal(t, num - 1 - len(found) < gapStart || num - 1 - len(found) >= gapEnd, exists)
+            }
+            require.Equal(t, expected, found)
+
+            // Seeking into the empty shards lands on the first key after them.
+            it.Seek(Key(gapStart + 1))
+            require.True(t, it.IsValid())
+            require.Equal(t, Key(gapEnd), it.Key())
+            it.Seek(Key(num))
+            require.False(t, it.IsValid())
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
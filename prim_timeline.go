@@ -3,6 +3,7 @@ package bundledb
 import (
     "bytes"
     "encoding/binary"
+    "time"
 )
 
 const (
@@ -10,18 +11,22 @@ const (
     TimelinePast = Key(1)
     TimelineCurrentKey = Key(2)
     headerTimeline = byte(60)
+    // A Timeline whose keys are written by SetNow.
+    headerTimelineClock = byte(61)
 )
 
 
 type timelineType struct{}
+func (x timelineType) Type() CollectionType { return TypeTimeline }
 func (x timelineType) Table() byte { panic("No Table for table") }
-func (x timelineType) NewPrimitive() Primitive { return &primTimeline{} }
+func (x timelineType) NewPrimitive() Primitive { return newPrimTimeline() }
 func (x timelineType) IsPointer(b []byte) bool { return false }
 func (x timelineType) IsPrimitive(b []byte) bool {
-    return b == nil  || len(b) == 0 || b[0] == headerTimeline
+    return b == nil  || len(b) == 0 || b[0] == headerTimeline || b[0] == headerTimelineClock
 }
 
 type primTimeline struct {
+    header byte
     currentKey Value
     currentVal Value
     tree Value
@@ -29,12 +34,13 @@ type primTimeline struct {
 }
 
 func newPrimTimeline() *primTimeline {
-    return &primTimeline{}
+    return &primTimeline{header: headerTimeline}
 }
 func (tline *primTimeline) MakePointer(shardId []byte) []byte {
     panic("No Pointer for Node")
 }
 func (tline *primTimeline) Reset() {
+    tline.header = headerTimeline
     tline.currentKey = TimelineCurrent
     tline.currentVal = nil
 }
@@ -49,9 +55,12 @@ func (tline *primTimeline) Max() Key { return TimelinePast }
 func (tline *primTimeline) Split() Primitive { return nil }
 func (tline *primTimeline) InRange(toCompare Key) bool { return true }
 func (tline *primTimeline) Serialize(w *bytes.Buffer) int {
-    w.WriteByte(headerTimeline)
+    w.WriteByte(tline.header)
     tot := 1
-    bytesSize := tline.currentVal.Serialize(w)
+    bytesSize := 0
+    if tline.currentVal != nil {
+        bytesSize = tline.currentVal.Serialize(w)
+    }
     tot += bytesSize
     tot += tline.currentKey.Serialize(w)
     if tline.tree != nil {
@@ -69,7 +78,10 @@ func (tline *primTimeline) Bytes() []byte {
     return b.Bytes()
 }
 func (tline *primTimeline) Size() int {
-    tot := 1 + 2 + KeyLength + tline.currentVal.Size()
+    tot := 1 + 2 + KeyLength
+    if tline.currentVal != nil {
+        tot += tline.currentVal.Size()
+    }
     if tline.tree != nil {
         tot += tline.tree.Size()
     }
@@ -79,6 +91,7 @@ func (tline *primTimeline) FromBytesReadOnly(stream []byte) error {
     buf := bytes.NewBuffer(stream)
     buf.Next(1)
     if stream != nil && len(stream) > 0 {
+        tline.header = stream[0]
         bytesSize := int(binary.LittleEndian.Uint16(stream[len(stream)-2:len(stream)]))
 
         tline.currentVal = RawVal(buf.Next(bytesSize))
@@ -147,6 +160,24 @@ type Timeline struct {
     currentVal []byte
     bund *Bundle
     mapBund *Bundle
+    retention *TimelineRetention
+    // The lowest key written to the past since the last prune, or MaxKey.
+    dirtyFrom Key
+    clock func() time.Time
+    // Whether the keys were written by SetNow. Only SetNow adds entries to such a Timeline.
+    clockKeys bool
+    // The error that stopped the last Keys or All loop.
+    iterErr error
+}
+
+// Which past versions of a Timeline to keep. Zero fields don't limit anything and the current value is always kept.
+type TimelineRetention struct {
+    // Keep at most this many versions, counting the current one.
+    KeepLast int
+    // Drop versions with keys before this.
+    KeepAfter Key
+    // Keep only the latest version in each run of BucketSize keys.
+    BucketSize Key
 }
 
 func timelineFromBundle(bund *Bundle) (*Timeline, error) {
@@ -159,18 +190,24 @@ func timelineFromBundle(bund *Bundle) (*Timeline, error) {
         return nil, err
     }
     var currentValBytes []byte
-    if currentVal != nil {
+    if currentVal != nil && len(currentVal.Bytes()) > 0 {
         currentValBytes = currentVal.Bytes()[1:]
     }
     mapBund, err := bund.FindBundle(DecodeMap, TimelinePast)
     if err != nil {
         return nil, err
     }
+    prim, err := bund.Primitive(TimelineCurrent)
+    if err != nil {
+        return nil, err
+    }
     return &Timeline{
         bund: bund,
         currentKey: BytesToKey(currentKey.Bytes()),
         currentVal: currentValBytes,
         mapBund: mapBund,
+        dirtyFrom: MaxKey,
+        clockKeys: prim.(*primTimeline).header == headerTimelineClock,
     }, nil
 }
 func (d *Timeline) Current() ([]byte, Key, error) {
@@ -186,7 +223,154 @@ func (d *Timeline) Past(key Key) ([]byte, bool, error) {
     }
     return nil, false, nil
 }
+// The latest entry at or before `key`.
+func (d *Timeline) At(key Key) ([]byte, Key, bool, error) {
+    if key >= d.currentKey && len(d.currentVal) > 0 {
+        return d.currentVal, d.currentKey, true, nil
+    }
+    found, ok, err := d.mapBund.Floor(key)
+    if err != nil || !ok {
+        return nil, 0, false, err
+    }
+    val, ok, err := d.Past(found)
+    return val, found, ok, err
+}
+
+type TimelineEntry struct {
+    Key Key
+    Value []byte
+}
+
+// The entries between `from` and `to` inclusive, oldest first.
+func (d *Timeline) Between(from, to Key) ([]TimelineEntry, error) {
+    it, err := d.Iterator()
+    if err != nil {
+        return nil, err
+    }
+    entries := []TimelineEntry{}
+    it = KeyRange(it, from, to)
+    for it.Seek(from); it.IsValid(); it.Next() {
+        val, ok, err := d.Past(it.Key())
+        if err != nil {
+            return nil, err
+        }
+        if ok && len(val) > 0 {
+            entries = append(entries, TimelineEntry{it.Key(), val})
+        }
+    }
+    return entries, nil
+}
+
+// The `n` most recent entries, newest first, starting with the current one.
+func (d *Timeline) Latest(n int) ([]TimelineEntry, error) {
+    entries := []TimelineEntry{}
+    key := MaxKey
+    for len(entries) < n {
+        val, found, ok, err := d.At(key)
+        if err != nil || !ok {
+            return entries, err
+        }
+        entries = append(entries, TimelineEntry{found, val})
+        if found == MinKey {
+            break
+        }
+        key = found - 1
+    }
+    return entries, nil
+}
+
+// Delete the past versions not kept by `policy`. Shards that are entirely too old are deleted without being read, so
+// unless BucketSize is set only the shard on the cutoff is loaded. With BucketSize every past key after the cutoff is read.
+func (d *Timeline) Prune(policy TimelineRetention) error {
+    return d.prune(policy, MinKey)
+}
+
+// Prune, only collapsing the buckets from the one holding `from`. Buckets before it already keep one version each.
+func (d *Timeline) prune(policy TimelineRetention, from Key) error {
+    cutoff := policy.KeepAfter
+    if policy.KeepLast > 0 {
+        kept, err := d.Latest(policy.KeepLast)
+        if err != nil {
+            return err
+        }
+        if len(kept) == policy.KeepLast && kept[len(kept) - 1].Key > cutoff {
+            cutoff = kept[len(kept) - 1].Key
+        }
+    }
+    if sb, ok := d.mapBund.iBundle.(*shardBundle); ok && cutoff > MinKey {
+        if err := sb.dropShardsIn(MinKey, cutoff - 1); err != nil {
+            return err
+        }
+    }
+
+    it, err := d.mapBund.Iterator()
+    if err != nil {
+        return err
+    }
+    drop := []Key{}
+    for it.Seek(MinKey); it.IsValid() && it.Key() < cutoff; it.Next() {
+        drop = append(drop, it.Key())
+    }
+    if policy.BucketSize > 0 && from < MaxKey {
+        start := from / policy.BucketSize * policy.BucketSize
+        if start < cutoff {
+            start = cutoff
+        }
+        past := []Key{}
+        for it.Seek(start); it.IsValid(); it.Next() {
+            past = append(past, it.Key())
+        }
+        for ii, key := range past {
+            next := d.currentKey
+            if ii + 1 < len(past) {
+                next = past[ii + 1]
+            }
+            if next / policy.BucketSize == key / policy.BucketSize && (ii + 1 < len(past) || len(d.currentVal) > 0) {
+                drop = append(drop, key)
+            }
+        }
+    }
+    if err := IterErr(it); err != nil {
+        return err
+    }
+    for _, key := range drop {
+        if _, err := d.mapBund.Delete(key); err != nil {
+            return err
+        }
+    }
+    d.dirtyFrom = MaxKey
+    return nil
+}
+
+// Prune with `policy` every time the Root holding the Timeline is committed, whether the Timeline is a root or nested.
+// BucketSize only collapses the buckets written through this Timeline since it was opened, so Prune once after
+// setting a new BucketSize on existing versions.
+func (d *Timeline) SetRetention(policy TimelineRetention) {
+    d.retention = &policy
+    d.bund.beforeCommit = func() error {
+        return d.prune(*d.retention, d.dirtyFrom)
+    }
+}
+
+func (d *Timeline) touch(key Key) {
+    if key < d.dirtyFrom {
+        d.dirtyFrom = key
+    }
+}
+
+// Set the value at `key`. A key after the current one makes it the current value, which a Timeline written by
+// SetNow only allows from SetNow.
 func (d *Timeline) Set(key Key, val []byte) (bool, error) {
+    if d.clockKeys && key > d.currentKey {
+        return false, ClockKeysOnly
+    }
+    return d.set(key, val)
+}
+func (d *Timeline) set(key Key, val []byte) (bool, error) {
+    if key != d.currentKey {
+        d.touch(d.currentKey)
+        d.touch(key)
+    }
     if key > d.currentKey {
         if d.currentVal != nil && len(d.currentVal) > 0 {
             _, err := d.mapBund.Write(d.currentKey, UserVal(d.currentVal))
@@ -3,6 +3,7 @@ package bundledb
 import (
     "fmt"
     "testing"
+    "time"
     "github.com/hansonkd/bundledb/store"
     "github.com/hansonkd/bundledb/store/badger"
     "github.com/stretchr/testify/require"
@@ -145,4 +146,273 @@ func TestTimelineIterator(t *testing.T) {
             return nil
         })
     })
-}
\ No newline at end of file
+}
+func TestTimelineAt(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 5
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootTimeline(Key(0), txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            for i := 1; i <= num; i++ {
+               _, err := mm.Set(Key(i * 10), []byte(fmt.Sprintf("%d", i * 10)))
+               require.NoError(t, err)
+            }
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+        db.View([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootTimeline(Key(0), txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            _, _, exists, err := mm.At(Key(5))
+            require.NoError(t, err)
+            require.False(t, exists)
+            for i := 1; i <= num; i++ {
+               val, key, exists, err := mm.At(Key(i * 10 + 5))
+               require.NoError(t, err)
+               require.True(t, exists)
+               require.Equal(t, Key(i * 10), key)
+               require.Equal(t, []byte(fmt.Sprintf("%d", i * 10)), val)
+            }
+
+            entries, err := mm.Between(Key(95), Key(130))
+            require.NoError(t, err)
+            require.Equal(t, []TimelineEntry{{100, []byte("100")}, {110, []byte("110")}, {120, []byte("120")}, {130, []byte("130")}}, entries)
+
+            entries, err = mm.Latest(3)
+            require.NoError(t, err)
+            require.Equal(t, 3, len(entries))
+            require.Equal(t, Key(num * 10), entries[0].Key)
+            require.Equal(t, Key(num * 10 - 20), entries[2].Key)
+            entries, err = mm.Latest(num + 10)
+            require.NoError(t, err)
+            require.Equal(t, num, len(entries))
+            require.Equal(t, Key(10), entries[num - 1].Key)
+            return nil
+        })
+    })
+}
+
+func TestTimelinePrune(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 5
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootTimeline(Key(0), txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            for i := 0; i < num; i++ {
+               _, err := mm.SetNext([]byte(fmt.Sprintf("%d", i)))
+               require.NoError(t, err)
+            }
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+
+        keys := func(mm *RootTimeline) []Key {
+            it, err := mm.Iterator()
+            require.NoError(t, err)
+            return Collect(it, -1)
+        }
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootTimeline(Key(0), txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            require.NoError(t, mm.Prune(TimelineRetention{KeepAfter: Key(num - 20)}))
+            // Only the shard on the cutoff was read.
+            require.True(t, len(mm.mapBund.iBundle.(*shardBundle).cache) <= 1)
+            require.Equal(t, 20, len(keys(mm)))
+            require.NoError(t, mm.Prune(TimelineRetention{BucketSize: Key(4)}))
+            require.Equal(t, []Key{31, 35, 39, 43, 47, 49}, keys(mm))
+
+            // Retention is applied again when committing.
+            mm.SetRetention(TimelineRetention{KeepLast: 3})
+            _, err = mm.SetNext([]byte("new"))
+            require.NoError(t, err)
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+
+        db.View([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootTimeline(Key(0), txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            require.Equal(t, []Key{47, 49, 50}, keys(mm))
+            val, key, exists, err := mm.At(Key(48))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, Key(47), key)
+            require.Equal(t, []byte("47"), val)
+            return nil
+        })
+    })
+}
+
+func TestTimelineHLC(t *testing.T) {
+    start := time.Unix(1700000000, 0)
+    now := start
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootTimeline(Key(0), txn)
+            require.NoError(t, err)
+            defer mm.Close()
+            mm.SetClock(func() time.Time { return now })
+
+            first, err := mm.SetNow([]byte("a"))
+            require.NoError(t, err)
+            require.Equal(t, start, HLCTime(first))
+            // Same millisecond, then a clock that went backwards.
+            second, err := mm.SetNow([]byte("b"))
+            require.NoError(t, err)
+            require.Equal(t, first + 1, second)
+            require.Equal(t, uint16(1), HLCLogical(second))
+            now = start.Add(-time.Second)
+            third, err := mm.SetNow([]byte("c"))
+            require.NoError(t, err)
+            require.Equal(t, second + 1, third)
+
+            now = start.Add(time.Minute)
+            _, err = mm.SetNow([]byte("d"))
+            require.NoError(t, err)
+            return mm.Commit()
+        })
+        require.NoError(t, err)
+
+        db.View([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootTimeline(Key(0), txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            _, _, exists, err := mm.AtTime(start.Add(-time.Millisecond))
+            require.NoError(t, err)
+            require.False(t, exists)
+            val, _, exists, err := mm.AtTime(start.Add(time.Second))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, []byte("c"), val)
+            val, key, _, err := mm.AtTime(start.Add(time.Hour))
+            require.NoError(t, err)
+            require.Equal(t, []byte("d"), val)
+            require.Equal(t, start.Add(time.Minute), HLCTime(key))
+            return nil
+        })
+
+        // The clock keys are stored with the Timeline, so other writes can't add keys that AtTime would misread.
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, err := GetRootTimeline(Key(0), txn)
+            require.NoError(t, err)
+            defer mm.Close()
+
+            _, current, _ := mm.Current()
+            _, err = mm.Set(current + 1, []byte("e"))
+            require.Equal(t, ClockKeysOnly, err)
+            _, err = mm.SetNext([]byte("e"))
+            require.Equal(t, ClockKeysOnly, err)
+            _, err = mm.SetLatest([]byte("e"))
+            require.NoError(t, err)
+
+            _, err = mm.set(MaxKey, []byte("f"))
+            require.NoError(t, err)
+            mm.SetClock(func() time.Time { return start })
+            _, err = mm.SetNow([]byte("g"))
+            require.Equal(t, ClockOverflow, err)
+
+            plain, err := GetRootTimeline(Key(1), txn)
+            require.NoError(t, err)
+            defer plain.Close()
+            _, _, exists, err := plain.AtTime(start)
+            require.NoError(t, err)
+            require.False(t, exists)
+            _, err = plain.SetNext([]byte("a"))
+            require.NoError(t, err)
+            _, err = plain.SetNow([]byte("b"))
+            require.Equal(t, NotClockTimeline, err)
+            _, _, _, err = plain.AtTime(start)
+            require.Equal(t, NotClockTimeline, err)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestTimelineNestedRetention(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 10
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+
+        keys := func(tl *Timeline) []Key {
+            it, err := tl.Iterator()
+            require.NoError(t, err)
+            return Collect(it, -1)
+        }
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            tl, err := root.FindTimeline(Key(7))
+            require.NoError(t, err)
+            tl.SetRetention(TimelineRetention{BucketSize: Key(4)})
+            for i := 0; i < num; i++ {
+                _, err := tl.SetNext([]byte(fmt.Sprintf("%d", i)))
+                require.NoError(t, err)
+            }
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        db.View([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            tl, err := root.FindTimeline(Key(7))
+            require.NoError(t, err)
+            // The nested Timeline was pruned by the root's commit.
+            require.Equal(t, num / 4, len(keys(tl)))
+            return nil
+        })
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            tl, err := root.FindTimeline(Key(7))
+            require.NoError(t, err)
+            tl.SetRetention(TimelineRetention{BucketSize: Key(4)})
+            _, err = tl.SetNext([]byte("new"))
+            require.NoError(t, err)
+            require.NoError(t, root.Commit())
+            // Only the buckets written since the last prune were read again.
+            require.True(t, len(tl.mapBund.iBundle.(*shardBundle).cache) <= 2)
+            return nil
+        })
+        require.NoError(t, err)
+
+        db.View([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            tl, err := root.FindTimeline(Key(7))
+            require.NoError(t, err)
+            found := keys(tl)
+            require.Equal(t, num / 4 + 1, len(found))
+            require.Equal(t, []Key{Key(num - 5), Key(num - 1), Key(num)}, found[len(found) - 3:])
+            require.Equal(t, Key(3), found[0])
+            return nil
+        })
+    })
+}
@@ -12,22 +12,28 @@ const (
 )
 
 
-type tupleType struct{}
+// Collections built on a Tuple get their own header and type so they can be told apart from a plain Tuple.
+type tupleType struct{
+    header byte
+    kind CollectionType
+}
+func (x tupleType) Type() CollectionType { return x.kind }
 func (x tupleType) Table() byte { panic("No Table for table") }
-func (x tupleType) NewPrimitive() Primitive { return &primTuple{} }
+func (x tupleType) NewPrimitive() Primitive { return &primTuple{header: x.header} }
 func (x tupleType) IsPointer(b []byte) bool { return false }
 func (x tupleType) IsPrimitive(b []byte) bool {
-    return b == nil  || len(b) == 0 || b[0] == headerTuple
+    return b == nil  || len(b) == 0 || b[0] == x.header
 }
 
 type primTuple struct {
+    header byte
     left Value
     right Value
     dirty bool
 }
 
 func newPrimTuple() *primTuple {
-    return &primTuple{}
+    return &primTuple{header: headerTuple}
 }
 func (pnode *primTuple) MakePointer(shardId []byte) []byte {
     panic("No Pointer for Node")
@@ -47,9 +53,14 @@ func (pnode *primTuple) Max() Key { return TupleRight }
 func (pnode *primTuple) Split() Primitive { return nil }
 func (pnode *primTuple) InRange(toCompare Key) bool { return true }
 func (pnode *primTuple) Serialize(w *bytes.Buffer) int {
-    w.WriteByte(headerTuple)
-    l := pnode.left.Serialize(w)
-    r := pnode.right.Serialize(w)
+    w.WriteByte(pnode.header)
+    l, r := 0, 0
+    if pnode.left != nil {
+        l = pnode.left.Serialize(w)
+    }
+    if pnode.right != nil {
+        r = pnode.right.Serialize(w)
+    }
     sz := make([]byte, 2)
     binary.LittleEndian.PutUint16(sz, uint16(l))
     a, _ := w.Write(sz)
@@ -75,9 +86,10 @@ func (pnode *primTuple) FromBytesReadOnly(stream []byte) error {
 
     buf.Next(1)
     if stream != nil && len(stream) > 0 {
+        pnode.header = stream[0]
         keyN := int(binary.LittleEndian.Uint16(stream[len(stream) - 2:]))
         value := buf.Next(keyN)
-        mm := buf.Next(len(stream) - 2)
+        mm := buf.Next(len(stream) - 1 - keyN - 2)
         pnode.left = RawVal(value)
         pnode.right = RawVal(mm)
 
@@ -0,0 +1,28 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/stretchr/testify/require"
+)
+
+func TestTupleRoundTrip(t *testing.T) {
+    // A tuple with only one side set used to panic when serialized.
+    pnode := newPrimTuple()
+    pnode.Write(TupleRight, UserVal("right"))
+    b := pnode.Bytes()
+
+    decoded := newPrimTuple()
+    require.NoError(t, decoded.FromBytesReadOnly(b))
+    left, _ := decoded.Read(TupleLeft)
+    require.Equal(t, 0, len(left.Bytes()))
+    right, _ := decoded.Read(TupleRight)
+    require.Equal(t, UserVal("right").Bytes(), right.Bytes())
+
+    // The right side used to be read with the trailing length of the left side attached.
+    pnode.Write(TupleLeft, UserVal("left"))
+    require.NoError(t, decoded.FromBytesReadOnly(pnode.Bytes()))
+    left, _ = decoded.Read(TupleLeft)
+    require.Equal(t, UserVal("left").Bytes(), left.Bytes())
+    right, _ = decoded.Read(TupleRight)
+    require.Equal(t, UserVal("right").Bytes(), right.Bytes())
+}
@@ -1,8 +1,13 @@
 package bundledb
 
+import (
+    "fmt"
+)
+
 
 // Holds information about how to decode a Primitive. These are passed when fetching Bundles, so the Bundle knows how to decode the underlying structure.
 type Decoder interface  {
+    Type() CollectionType
     Table() byte
     NewPrimitive() Primitive
     IsPrimitive([]byte) bool
@@ -42,6 +47,63 @@ type Primitive interface {
     InRange(Key) bool
 }
 
+// The kind of collection stored in a bundle value. The first byte of every stored value identifies it, so opening
+// a bundle with a Decoder of a different type can be detected instead of mis-decoding the bytes.
+type CollectionType byte
 
+const (
+    TypeUnknown = CollectionType(0)
+    TypeValue = CollectionType(1)
+    TypeMap = CollectionType(2)
+    TypeSet = CollectionType(3)
+    TypeList = CollectionType(4)
+    TypeTimeline = CollectionType(5)
+    TypeTuple = CollectionType(6)
+    TypeHyperLogLog = CollectionType(7)
+    TypeBloom = CollectionType(8)
+    TypeSortedSet = CollectionType(9)
+    TypeMultiMap = CollectionType(10)
+    TypeBitmap = CollectionType(11)
+    TypeStream = CollectionType(12)
+)
 
+func (t CollectionType) String() string {
+    switch t {
+    case TypeValue:
+        return "Value"
+    case TypeMap:
+        return "Map"
+    case TypeSet:
+        return "Set"
+    case TypeList:
+        return "List"
+    case TypeTimeline:
+        return "Timeline"
+    case TypeTuple:
+        return "Tuple"
+    case TypeHyperLogLog:
+        return "HyperLogLog"
+    case TypeBloom:
+        return "Bloom"
+    case TypeSortedSet:
+        return "SortedSet"
+    case TypeMultiMap:
+        return "MultiMap"
+    case TypeBitmap:
+        return "Bitmap"
+    case TypeStream:
+        return "Stream"
+    }
+    return fmt.Sprintf("CollectionType(%d)", byte(t))
+}
 
+// Returned when a bundle is opened with a Decoder that doesn't match the collection stored at its path.
+type ErrTypeMismatch struct {
+    Path []Key
+    Expected CollectionType
+    Found CollectionType
+}
+
+func (e *ErrTypeMismatch) Error() string {
+    return fmt.Sprintf("Type mismatch at %v: expected %s, found %s", e.Path, e.Expected, e.Found)
+}
@@ -0,0 +1,343 @@
+package bundledb
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+type QueryOp int
+
+const (
+    QueryTerm QueryOp = iota
+    QueryAnd
+    QueryOr
+)
+
+// A parsed boolean query. A QueryAnd matches keys in all of Children and none of Exclude.
+type QueryNode struct {
+    Op QueryOp
+    Term string
+    Children []*QueryNode
+    Exclude []*QueryNode
+}
+
+type ErrQuerySyntax struct {
+    Pos int
+    Msg string
+}
+
+func (e *ErrQuerySyntax) Error() string {
+    return fmt.Sprintf("Query syntax error at %d: %s", e.Pos, e.Msg)
+}
+
+func (n *QueryNode) String() string {
+    switch n.Op {
+    case QueryTerm:
+        return n.Term
+    case QueryOr:
+        parts := make([]string, len(n.Children))
+        for ii, c := range n.Children {
+            parts[ii] = c.String()
+        }
+        return "(" + strings.Join(parts, " OR ") + ")"
+    default:
+        parts := make([]string, 0, len(n.Children) + len(n.Exclude))
+        for _, c := range n.Children {
+            parts = append(parts, c.String())
+        }
+        for _, c := range n.Exclude {
+            parts = append(parts, "NOT " + c.String())
+        }
+        return "(" + strings.Join(parts, " AND ") + ")"
+    }
+}
+
+type queryToken struct {
+    text string
+    pos int
+}
+
+func tokenizeQuery(expr string) []queryToken {
+    tokens := []queryToken{}
+    start := -1
+    flush := func(end int) {
+        if start >= 0 {
+            tokens = append(tokens, queryToken{expr[start:end], start})
+            start = -1
+        }
+    }
+    for ii, r := range expr {
+        switch {
+        case r == '(' || r == ')':
+            flush(ii)
+            tokens = append(tokens, queryToken{string(r), ii})
+        case r == ' ' || r == '\t' || r == '\n':
+            flush(ii)
+        case start < 0:
+            start = ii
+        }
+    }
+    flush(len(expr))
+    return tokens
+}
+
+type queryParser struct {
+    tokens []queryToken
+    ii int
+    end int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+    if p.ii >= len(p.tokens) {
+        return queryToken{"", p.end}, false
+    }
+    return p.tokens[p.ii], true
+}
+
+func (p *queryParser) keyword(word string) bool {
+    tok, ok := p.peek()
+    if ok && strings.EqualFold(tok.text, word) {
+        p.ii++
+        return true
+    }
+    return false
+}
+
+func (p *queryParser) parseOr() (*QueryNode, error) {
+    left, err := p.parseAnd()
+    if err != nil {
+        return nil, err
+    }
+    node := &QueryNode{Op: QueryOr, Children: []*QueryNode{left}}
+    for p.keyword("OR") {
+        right, err := p.parseAnd()
+        if err != nil {
+            return nil, err
+        }
+        node.Children = append(node.Children, right)
+    }
+    if len(node.Children) == 1 {
+        return left, nil
+    }
+    return flatten(node), nil
+}
+
+// Terms next to each other are ANDed, so "a b" is "a AND b" and "a NOT b" is "a AND NOT b".
+func (p *queryParser) parseAnd() (*QueryNode, error) {
+    node := &QueryNode{Op: QueryAnd}
+    for {
+        tok, ok := p.peek()
+        if !ok || tok.text == ")" || strings.EqualFold(tok.text, "OR") {
+            break
+        }
+        if len(node.Children) + len(node.Exclude) > 0 {
+            p.keyword("AND")
+        }
+        negate := p.keyword("NOT")
+        child, err := p.parsePrimary()
+        if err != nil {
+            return nil, err
+        }
+        if negate {
+            node.Exclude = append(node.Exclude, child)
+        } else {
+            node.Children = append(node.Children, child)
+        }
+    }
+    tok, _ := p.peek()
+    switch {
+    case len(node.Children) == 0 && len(node.Exclude) == 0:
+        return nil, &ErrQuerySyntax{tok.pos, "expected a term"}
+    case len(node.Children) == 0:
+        return nil, &ErrQuerySyntax{tok.pos, "NOT needs a term to subtract from"}
+    case len(node.Children) == 1 && len(node.Exclude) == 0:
+        return node.Children[0], nil
+    }
+    return flatten(node), nil
+}
+
+func (p *queryParser) parsePrimary() (*QueryNode, error) {
+    tok, ok := p.peek()
+    if !ok {
+        return nil, &ErrQuerySyntax{tok.pos, "unexpected end of query"}
+    }
+    switch {
+    case tok.text == "(":
+        p.ii++
+        node, err := p.parseOr()
+        if err != nil {
+            return nil, err
+        }
+        if closing, ok := p.peek(); !ok || closing.text != ")" {
+            return nil, &ErrQuerySyntax{closing.pos, "expected )"}
+        }
+        p.ii++
+        return node, nil
+    case tok.text == ")" || strings.EqualFold(tok.text, "AND") || strings.EqualFold(tok.text, "OR") || strings.EqualFold(tok.text, "NOT"):
+        return nil, &ErrQuerySyntax{tok.pos, fmt.Sprintf("unexpected %s", tok.text)}
+    }
+    p.ii++
+    return &QueryNode{Op: QueryTerm, Term: tok.text}, nil
+}
+
+// Merge children that have the same operator as their parent, so "a AND (b AND c)" becomes one intersection.
+func flatten(node *QueryNode) *QueryNode {
+    children := []*QueryNode{}
+    for _, c := range node.Children {
+        if c.Op == node.Op {
+            children = append(children, c.Children...)
+            node.Exclude = append(node.Exclude, c.Exclude...)
+        } else {
+            children = append(children, c)
+        }
+    }
+    node.Children = children
+    return node
+}
+
+// Parse a boolean query such as "tag:a AND (tag:b OR tag:c) NOT tag:d". AND binds tighter than OR, and terms
+// next to each other are ANDed. NOT can only subtract from other terms.
+func ParseQuery(expr string) (*QueryNode, error) {
+    p := &queryParser{tokens: tokenizeQuery(expr), end: len(expr)}
+    node, err := p.parseOr()
+    if err != nil {
+        return nil, err
+    }
+    if tok, ok := p.peek(); ok {
+        return nil, &ErrQuerySyntax{tok.pos, fmt.Sprintf("unexpected %s", tok.text)}
+    }
+    return node, nil
+}
+
+// The default way to find the Set for a term. Each part of the term between colons is a key, so "tag:a" is the
+// Set at FindSet(StrToKey("tag"), StrToKey("a")).
+func DefaultQueryPath(term string) ([]Key, error) {
+    parts := strings.Split(term, ":")
+    keys := make([]Key, len(parts))
+    for ii, part := range parts {
+        k, err := StrToKeyStrict(part)
+        if err != nil {
+            return nil, err
+        }
+        keys[ii] = k
+    }
+    return keys, nil
+}
+
+type planNode struct {
+    label string
+    it BundleIterator
+    children []*planNode
+}
+
+// An iterator tree built from a QueryNode.
+type QueryPlan struct {
+    Iterator BundleIterator
+    root *planNode
+}
+
+func formatEstimate(it BundleIterator) string {
+    if size := estimatedSize(it); size < unknownSize {
+        return fmt.Sprintf("%d", size)
+    }
+    return "?"
+}
+
+// A description of the iterator tree, one iterator per line, with the estimated number of keys of each.
+func (plan *QueryPlan) Explain() string {
+    var b strings.Builder
+    var walk func(*planNode, int)
+    walk = func(n *planNode, depth int) {
+        fmt.Fprintf(&b, "%s%s (est %s)\n", strings.Repeat("  ", depth), n.label, formatEstimate(n.it))
+        for _, c := range n.children {
+            walk(c, depth + 1)
+        }
+    }
+    walk(plan.root, 0)
+    return b.String()
+}
+
+// Parse `expr` and plan it against the Sets nested in this bundle using DefaultQueryPath.
+func (bndl *Bundle) Query(expr string) (*QueryPlan, error) {
+    node, err := ParseQuery(expr)
+    if err != nil {
+        return nil, err
+    }
+    return bndl.PlanQuery(node, DefaultQueryPath)
+}
+
+// Build an iterator tree for `node`, finding the Set for each term at the path returned by `resolve`.
+// The inputs of each intersection are ordered smallest first by their estimated size.
+func (bndl *Bundle) PlanQuery(node *QueryNode, resolve func(string) ([]Key, error)) (*QueryPlan, error) {
+    root, err := bndl.planQuery(node, resolve)
+    if err != nil {
+        return nil, err
+    }
+    return &QueryPlan{root.it, root}, nil
+}
+
+func (bndl *Bundle) planQuery(node *QueryNode, resolve func(string) ([]Key, error)) (*planNode, error) {
+    if node.Op == QueryTerm {
+        path, err := resolve(node.Term)
+        if err != nil {
+            return nil, err
+        }
+        s, err := bndl.FindSet(path...)
+        if err != nil {
+            return nil, err
+        }
+        it, err := s.Iterator()
+        if err != nil {
+            return nil, err
+        }
+        return &planNode{label: "Set " + node.Term, it: it}, nil
+    }
+    children, err := bndl.planChildren(node.Children, resolve)
+    if err != nil {
+        return nil, err
+    }
+    its := make([]BundleIterator, len(children))
+    if node.Op == QueryOr {
+        for ii, c := range children {
+            its[ii] = c.it
+        }
+        return &planNode{label: "Union", it: Union(its...), children: children}, nil
+    }
+
+    sort.SliceStable(children, func(i, j int) bool {
+        return estimatedSize(children[i].it) < estimatedSize(children[j].it)
+    })
+    for ii, c := range children {
+        its[ii] = c.it
+    }
+    base := children[0]
+    if len(children) > 1 {
+        base = &planNode{label: "Intersect", it: Intersect(its...), children: children}
+    }
+    if len(node.Exclude) == 0 {
+        return base, nil
+    }
+    excluded, err := bndl.planChildren(node.Exclude, resolve)
+    if err != nil {
+        return nil, err
+    }
+    exclude := make([]BundleIterator, len(excluded))
+    for ii, c := range excluded {
+        exclude[ii] = c.it
+        c.label = "Exclude " + c.label
+    }
+    return &planNode{label: "Difference", it: Difference(base.it, exclude...), children: append([]*planNode{base}, excluded...)}, nil
+}
+
+func (bndl *Bundle) planChildren(nodes []*QueryNode, resolve func(string) ([]Key, error)) ([]*planNode, error) {
+    plans := make([]*planNode, len(nodes))
+    for ii, n := range nodes {
+        p, err := bndl.planQuery(n, resolve)
+        if err != nil {
+            return nil, err
+        }
+        plans[ii] = p
+    }
+    return plans, nil
+}
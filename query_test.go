@@ -0,0 +1,85 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestParseQuery(t *testing.T) {
+    cases := []struct {
+        expr string
+        expected string
+    }{
+        {"tag:a", "tag:a"},
+        {"tag:a AND (tag:b OR tag:c) NOT tag:d", "(tag:a AND (tag:b OR tag:c) AND NOT tag:d)"},
+        {"a b or c", "((a AND b) OR c)"},
+        {"a and (b and not c) or (d or e)", "((a AND b AND NOT c) OR d OR e)"},
+    }
+    for _, c := range cases {
+        node, err := ParseQuery(c.expr)
+        require.NoError(t, err)
+        require.Equal(t, c.expected, node.String())
+    }
+    for _, expr := range []string{"", "NOT a", "a AND", "(a OR b", "a )", "a OR OR b"} {
+        _, err := ParseQuery(expr)
+        _, ok := err.(*ErrQuerySyntax)
+        require.True(t, ok, expr)
+    }
+}
+
+func TestQuery(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            tags := map[string]int{"a": 1, "b": 2, "c": 3, "d": 5}
+            for tag, every := range tags {
+                s, err := root.FindSet(StrToKey("tag"), StrToKey(tag))
+                require.NoError(t, err)
+                for x := 0; x < 60; x += every {
+                    s.Add(Key(x))
+                }
+            }
+            small, _ := root.FindSet(StrToKey("tag"), StrToKey("e"))
+            small.Add(Key(30))
+            small.Add(Key(33))
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, err := GetRootBundle(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+
+            plan, err := root.Query("tag:a AND (tag:b OR tag:c) NOT tag:d")
+            require.NoError(t, err)
+            keys := Collect(plan.Iterator, -1)
+            require.Equal(t, []Key{2, 3, 4, 6, 8, 9, 12, 14, 16}, keys[:9])
+            for _, k := range keys {
+                require.True(t, (k % 2 == 0 || k % 3 == 0) && k % 5 != 0)
+            }
+
+            // Sets are ordered smallest first, sharded ones by their number of shards.
+            plan, err = root.Query("tag:a tag:b tag:e")
+            require.NoError(t, err)
+            require.Equal(t, []Key{30}, Collect(plan.Iterator, -1))
+            require.Equal(t, "Intersect (est 2)\n  Set tag:e (est 2)\n  Set tag:b (est 21)\n  Set tag:a (est 42)\n", plan.Explain())
+
+            plan, err = root.Query("tag:e NOT tag:b")
+            require.NoError(t, err)
+            require.Equal(t, []Key{33}, Collect(plan.Iterator, -1))
+            require.Equal(t, "Difference (est 2)\n  Set tag:e (est 2)\n  Exclude Set tag:b (est 21)\n", plan.Explain())
+
+            _, err = root.Query("tag:toolongtoindex")
+            require.Equal(t, KeyTooLong, err)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
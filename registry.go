@@ -0,0 +1,253 @@
+package bundledb
+
+import (
+    "errors"
+    "sync"
+    "github.com/hansonkd/bundledb/store"
+)
+
+var (
+    HeaderInUse = errors.New("Header byte is already registered to another Decoder")
+    TableInUse = errors.New("Table byte is already registered to another Decoder")
+    TypeInUse = errors.New("CollectionType is already registered to another Decoder")
+    NoCollection = errors.New("No collection is stored at key")
+
+    registry = newDecoderRegistry()
+)
+
+// Describes how to recognize a Decoder's values when the caller doesn't know the type ahead of time.
+type DecoderRegistration struct {
+    Decoder Decoder
+    // Every byte the Decoder's primitives and pointers can start with.
+    Headers []byte
+    // Table bytes the Decoder writes shards to. Leave empty if the primitive never shards.
+    Tables []byte
+    // Wraps an opened bundle in its collection type. If nil, OpenAny and ChildAny return the *Bundle itself.
+    Wrap func(*Bundle) (interface{}, error)
+}
+
+type decoderRegistry struct {
+    sync.RWMutex
+    headers map[byte]*DecoderRegistration
+    tables map[byte]*DecoderRegistration
+    types map[CollectionType]*DecoderRegistration
+}
+
+func newDecoderRegistry() *decoderRegistry {
+    return &decoderRegistry{
+        headers: make(map[byte]*DecoderRegistration),
+        tables: make(map[byte]*DecoderRegistration),
+        types: make(map[CollectionType]*DecoderRegistration),
+    }
+}
+
+func init() {
+    builtins := []DecoderRegistration{
+        {
+            Decoder: DecodeMap,
+            Headers: []byte{headerMapPrim, headerMapPointer, headerMapDense},
+            Tables: []byte{tableMap},
+            Wrap: func(b *Bundle) (interface{}, error) { return mapFromBundle(b) },
+        },
+        {
+            Decoder: DecodeSet,
+            Headers: []byte{headerSetEmbed, headerSetPointer},
+            Tables: []byte{tableSet},
+            Wrap: func(b *Bundle) (interface{}, error) { return setFromBundle(b) },
+        },
+        {
+            Decoder: DecodeList,
+            Headers: []byte{headerList},
+            Wrap: func(b *Bundle) (interface{}, error) { return listFromBundle(b) },
+        },
+        {
+            Decoder: DecodeTimeline,
+            Headers: []byte{headerTimeline, headerTimelineClock},
+            Wrap: func(b *Bundle) (interface{}, error) { return timelineFromBundle(b) },
+        },
+        {
+            Decoder: DecodeTuple,
+            Headers: []byte{headerTuple},
+        },
+        {
+            Decoder: DecodeSortedSet,
+            Headers: []byte{headerSortedSet},
+            Wrap: func(b *Bundle) (interface{}, error) { return sortedSetFromBundle(b) },
+        },
+        {
+            Decoder: DecodeMultiMap,
+            Headers: []byte{headerMultiMap, headerMultiMapReverse},
+            Wrap: func(b *Bundle) (interface{}, error) { return multiMapFromBundle(b, MultiMapOptions{}) },
+        },
+        {
+            Decoder: DecodeHyperLogLog,
+            Headers: []byte{headerHLLSparse, headerHLLDense},
+            Wrap: func(b *Bundle) (interface{}, error) { return hyperLogLogFromBundle(b) },
+        },
+        {
+            Decoder: DecodeBitmap,
+            Headers: []byte{headerBitmapPrim, headerBitmapPointer, headerBitmapDense},
+            Wrap: func(b *Bundle) (interface{}, error) { return bitmapFromBundle(b) },
+        },
+        {
+            Decoder: DecodeStream,
+            Headers: []byte{headerStreamPrim, headerStreamPointer, headerStreamDense},
+            Wrap: func(b *Bundle) (interface{}, error) { return streamFromBundle(b) },
+        },
+        {
+            Decoder: DecodeBloom,
+            Headers: []byte{headerBloom, headerBloomPointer},
+            Tables: []byte{tableBloom},
+            Wrap: func(b *Bundle) (interface{}, error) { return bloomFilterFromBundle(b) },
+        },
+    }
+    // Reserved for user values, root pointers, the expiry index, blob chunks, the blob index and the Bloom filters of Sets.
+    registry.headers[headerUser] = &DecoderRegistration{}
+    registry.headers[headerUserExpiring] = &DecoderRegistration{}
+    registry.headers[headerUserBlob] = &DecoderRegistration{}
+    registry.tables[tableTopLevel] = &DecoderRegistration{}
+    registry.tables[tableExpire] = &DecoderRegistration{}
+    registry.tables[tableBlob] = &DecoderRegistration{}
+    registry.tables[tableSetBloom] = &DecoderRegistration{}
+    registry.tables[tableBlobIndex] = &DecoderRegistration{}
+    registry.types[TypeUnknown] = &DecoderRegistration{}
+    registry.types[TypeValue] = &DecoderRegistration{}
+    for _, reg := range builtins {
+        if err := RegisterDecoder(reg); err != nil {
+            panic(err)
+        }
+    }
+}
+
+// Register a Decoder so that OpenAny and ChildAny can detect it and so that opening it with the wrong Decoder
+// returns an *ErrTypeMismatch. The Decoder's Type, headers and tables must not collide with any other registration.
+func RegisterDecoder(reg DecoderRegistration) error {
+    registry.Lock()
+    defer registry.Unlock()
+
+    if _, ok := registry.types[reg.Decoder.Type()]; ok {
+        return TypeInUse
+    }
+    for _, h := range reg.Headers {
+        if _, ok := registry.headers[h]; ok {
+            return HeaderInUse
+        }
+    }
+    for _, t := range reg.Tables {
+        if _, ok := registry.tables[t]; ok {
+            return TableInUse
+        }
+    }
+
+    r := &reg
+    registry.types[reg.Decoder.Type()] = r
+    for _, h := range reg.Headers {
+        registry.headers[h] = r
+    }
+    for _, t := range reg.Tables {
+        registry.tables[t] = r
+    }
+    return nil
+}
+
+// Find the registered Decoder whose values start with `header`.
+func DecoderForHeader(header byte) (Decoder, bool) {
+    registry.RLock()
+    defer registry.RUnlock()
+    reg, ok := registry.headers[header]
+    if !ok || reg.Decoder == nil {
+        return nil, false
+    }
+    return reg.Decoder, true
+}
+
+func registrationFor(b []byte) *DecoderRegistration {
+    if len(b) == 0 {
+        return nil
+    }
+    registry.RLock()
+    defer registry.RUnlock()
+    return registry.headers[b[0]]
+}
+
+// Find which collection wrote `b` from its header byte.
+func storedType(b []byte) CollectionType {
+    if len(b) == 0 {
+        return TypeUnknown
+    }
+    if b[0] == headerUser || b[0] == headerUserExpiring || b[0] == headerUserBlob {
+        return TypeValue
+    }
+    if reg := registrationFor(b); reg != nil && reg.Decoder != nil {
+        return reg.Decoder.Type()
+    }
+    return TypeUnknown
+}
+
+func wrapAny(bndl *Bundle, reg *DecoderRegistration) (interface{}, error) {
+    if reg.Wrap == nil {
+        return bndl, nil
+    }
+    return reg.Wrap(bndl)
+}
+
+// Open the collection stored under `key` without knowing its type. The result is a *Map, *Set, *List, *Timeline,
+// *HyperLogLog, *BloomFilter, *Bitmap or *Stream for the built in collections, the *Bundle for other registered Decoders, a *Blob, or the []byte for a plain value.
+// Returns NoCollection if nothing is stored under `key`.
+func (bndl *Bundle) ChildAny(key Key) (interface{}, error) {
+    prim, err := bndl.Primitive(key)
+    if err != nil {
+        return nil, err
+    }
+    var b []byte
+    if state, ok := prim.Read(key); ok && state != nil {
+        b = state.Bytes()
+    }
+    if len(b) == 0 {
+        return nil, NoCollection
+    }
+    if ref, ok := blobRefFromBytes(b); ok {
+        return &Blob{bndl.txn, ref}, nil
+    }
+    if b[0] == headerUser || b[0] == headerUserExpiring {
+        if val, ok := userBytes(b); ok {
+            return val, nil
+        }
+        return nil, NoCollection
+    }
+    reg := registrationFor(b)
+    if reg == nil || reg.Decoder == nil {
+        return nil, InvalidHeader
+    }
+    child, err := bndl.child(key, reg.Decoder, RawVal(b))
+    if err != nil {
+        return nil, err
+    }
+    return wrapAny(child, reg)
+}
+
+// Open a Root without knowing its type. The returned collection follows the same rules as ChildAny.
+// Returns NoCollection if the root has never been committed.
+func OpenAny(root Key, txn *store.Txn) (*Root, interface{}, error) {
+    state, err := readRootState(root, txn)
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(state) == 0 {
+        return nil, nil, NoCollection
+    }
+    reg := registrationFor(state)
+    if reg == nil || reg.Decoder == nil {
+        return nil, nil, InvalidHeader
+    }
+    r, err := newRoot(root, reg.Decoder, state, txn)
+    if err != nil {
+        return nil, nil, err
+    }
+    coll, err := wrapAny(r.Bundle, reg)
+    if err != nil {
+        r.Close()
+        return nil, nil, err
+    }
+    return r, coll, nil
+}
@@ -0,0 +1,130 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestOpenAny(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            mm, _ := GetRootMap(Key(0), txn)
+            defer mm.Close()
+            for x := 0; x < MAX_SHARD_MAP_SIZE * 2; x++ {
+                mm.Insert(Key(x), []byte("cool"))
+            }
+            nested, _ := mm.root.FindSet(Key(100), Key(1))
+            nested.Add(Key(5))
+
+            l, _ := GetRootList(Key(1), txn)
+            defer l.Close()
+            l.RPush([]byte("cool"))
+
+            tl, _ := GetRootTimeline(Key(2), txn)
+            defer tl.Close()
+            tl.SetNext([]byte("cool"))
+
+            for _, err := range []error{mm.Commit(), l.Commit(), tl.Commit()} {
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, coll, err := OpenAny(Key(0), txn)
+            require.NoError(t, err)
+            defer root.Close()
+            m, ok := coll.(*Map)
+            require.True(t, ok)
+            val, _, _ := m.Lookup(Key(3))
+            require.Equal(t, []byte("cool"), val)
+
+            child, err := root.ChildAny(Key(3))
+            require.NoError(t, err)
+            require.Equal(t, []byte("cool"), child)
+
+            child, err = root.ChildAny(Key(100))
+            require.NoError(t, err)
+            inner, ok := child.(*Map)
+            require.True(t, ok)
+            child, err = inner.bund.ChildAny(Key(1))
+            require.NoError(t, err)
+            s, ok := child.(*Set)
+            require.True(t, ok)
+            exists, _ := s.Contains(Key(5))
+            require.True(t, exists)
+
+            _, err = root.ChildAny(Key(99))
+            require.Equal(t, NoCollection, err)
+
+            lroot, coll, err := OpenAny(Key(1), txn)
+            require.NoError(t, err)
+            defer lroot.Close()
+            _, ok = coll.(*List)
+            require.True(t, ok)
+
+            troot, coll, err := OpenAny(Key(2), txn)
+            require.NoError(t, err)
+            defer troot.Close()
+            _, ok = coll.(*Timeline)
+            require.True(t, ok)
+
+            _, _, err = OpenAny(Key(3), txn)
+            require.Equal(t, NoCollection, err)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+type testCustomType struct{ tupleType }
+func (x testCustomType) Type() CollectionType { return CollectionType(100) }
+
+// Swap in a copy of the registry so a test can register decoders without changing it for the tests after it. Call
+// the returned func to put the original back.
+func isolateRegistry() func() {
+    saved := registry
+    registry = newDecoderRegistry()
+    for h, r := range saved.headers {
+        registry.headers[h] = r
+    }
+    for tb, r := range saved.tables {
+        registry.tables[tb] = r
+    }
+    for ty, r := range saved.types {
+        registry.types[ty] = r
+    }
+    return func() { registry = saved }
+}
+
+func TestRegisterDecoder(t *testing.T) {
+    defer isolateRegistry()()
+    require.Equal(t, TypeInUse, RegisterDecoder(DecoderRegistration{Decoder: DecodeMap}))
+    require.Equal(t, HeaderInUse, RegisterDecoder(DecoderRegistration{Decoder: testCustomType{}, Headers: []byte{headerTuple}}))
+    require.Equal(t, HeaderInUse, RegisterDecoder(DecoderRegistration{Decoder: testCustomType{}, Headers: []byte{headerUser}}))
+    require.Equal(t, TableInUse, RegisterDecoder(DecoderRegistration{Decoder: testCustomType{}, Headers: []byte{200}, Tables: []byte{tableMap}}))
+    require.Equal(t, TableInUse, RegisterDecoder(DecoderRegistration{Decoder: testCustomType{}, Headers: []byte{200}, Tables: []byte{tableTopLevel}}))
+
+    // Failed registrations must not leave anything behind.
+    _, ok := DecoderForHeader(200)
+    require.False(t, ok)
+
+    require.NoError(t, RegisterDecoder(DecoderRegistration{Decoder: testCustomType{}, Headers: []byte{200}, Tables: []byte{200}}))
+    d, ok := DecoderForHeader(200)
+    require.True(t, ok)
+    require.Equal(t, CollectionType(100), d.Type())
+    require.Equal(t, CollectionType(100), storedType([]byte{200}))
+}
+
+func TestRegisterDecoderIsolated(t *testing.T) {
+    // Runs after TestRegisterDecoder, which must not have left its decoder behind.
+    _, ok := DecoderForHeader(200)
+    require.False(t, ok)
+    require.Equal(t, TypeUnknown, storedType([]byte{200}))
+}
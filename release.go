@@ -0,0 +1,69 @@
+package bundledb
+
+import (
+    "github.com/hansonkd/bundledb/store"
+)
+
+// Delete everything stored outside of `b` for the value at `path`: blob chunks, expiry index rows, shards,
+// the Bloom filter of a Set and the same for every value nested inside it. The caller removes `b` itself.
+func releaseValue(txn *store.Txn, path []Key, b []byte) error {
+    if len(b) == 0 {
+        return nil
+    }
+    if ref, ok := blobRefFromBytes(b); ok {
+        return dropBlobAt(txn, path, ref)
+    }
+    if b[0] == headerUserExpiring && len(b) >= 1 + KeyLength {
+        return txn.Delete(expireIndexKey(BytesToKey(b[1:1 + KeyLength]), path))
+    }
+    reg := registrationFor(b)
+    if reg == nil || reg.Decoder == nil {
+        return nil
+    }
+    if setBytesHaveBloom(b) {
+        if err := dropSetBloom(txn, path); err != nil {
+            return err
+        }
+    }
+    switch reg.Decoder.Type() {
+    case TypeSet, TypeHyperLogLog, TypeBloom:
+        // Members don't have values, so nothing can be nested.
+    default:
+        if err := releaseNested(txn, path, reg.Decoder, b); err != nil {
+            return err
+        }
+    }
+    if reg.Decoder.IsPointer(b) {
+        return dropShards(txn, append([]byte{reg.Decoder.Table()}, b[1:9]...))
+    }
+    return nil
+}
+
+func releaseNested(txn *store.Txn, path []Key, primType Decoder, b []byte) error {
+    bndl, err := newBundle(txn, path, primType, b)
+    if err != nil {
+        return err
+    }
+    defer bndl.close()
+    it, err := bndl.Iterator()
+    if err != nil {
+        return err
+    }
+    keys := []Key{}
+    for it.Seek(MinKey); it.IsValid(); it.Next() {
+        keys = append(keys, it.Key())
+    }
+    for _, key := range keys {
+        val, exists, err := bndl.Read(key)
+        if err != nil {
+            return err
+        }
+        if !exists || val == nil {
+            continue
+        }
+        if err := releaseValue(txn, append(append([]Key{}, path...), key), val.Bytes()); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,79 @@
+package bundledb
+
+import (
+    "github.com/hansonkd/bundledb/store"
+)
+
+// The Bloom filter of a Set is stored under the path of the Set, so any handle that opens the Set can find it.
+func setBloomKey(path []Key) []byte {
+    b := []byte{tableSetBloom}
+    for _, k := range path {
+        b = append(b, k.Bytes()...)
+    }
+    return b
+}
+
+// Whether the stored bytes of a Set say it has a Bloom filter. Embedded Sets keep a flag next to openMin and
+// pointers have an extra byte after the shard id.
+func setBytesHaveBloom(b []byte) bool {
+    switch {
+    case len(b) > 1 && b[0] == headerSetEmbed:
+        return b[1] & 2 != 0
+    case len(b) > 9 && b[0] == headerSetPointer:
+        return b[9] == 1
+    }
+    return false
+}
+
+func (bndl *Bundle) hasSetBloom() bool {
+    switch b := bndl.iBundle.(type) {
+    case *primBundle:
+        pset, ok := b.prim.(*primSet)
+        return ok && pset.bloom
+    case *shardBundle:
+        return b.primType.Type() == TypeSet && setBytesHaveBloom(b.primBytes)
+    }
+    return false
+}
+
+// Load the Bloom filter of a Set the first time it's needed. Returns nil if the Set doesn't have one.
+func (bndl *Bundle) setBloom() (*Bundle, error) {
+    if bndl.bloom != nil || !bndl.hasSetBloom() {
+        return bndl.bloom, nil
+    }
+    state, err := readSetBloom(bndl.txn, bndl.rootPath)
+    if err != nil {
+        return nil, err
+    }
+    bloom, err := newBundle(bndl.txn, bndl.rootPath, DecodeBloom, state)
+    if err != nil {
+        return nil, err
+    }
+    bndl.bloom = bloom
+    return bloom, nil
+}
+
+func readSetBloom(txn *store.Txn, path []Key) ([]byte, error) {
+    switch item, err := txn.Get(setBloomKey(path)); {
+    case err == nil:
+        return item.Value()
+    case err == store.ErrKeyNotFound:
+        return nil, nil
+    default:
+        return nil, err
+    }
+}
+
+// Delete the Bloom filter stored for the Set at `path`.
+func dropSetBloom(txn *store.Txn, path []Key) error {
+    state, err := readSetBloom(txn, path)
+    if err != nil || state == nil {
+        return err
+    }
+    if DecodeBloom.IsPointer(state) {
+        if err := dropShards(txn, append([]byte{tableBloom}, state[1:9]...)); err != nil {
+            return err
+        }
+    }
+    return txn.Delete(setBloomKey(path))
+}
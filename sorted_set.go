@@ -0,0 +1,271 @@
+package bundledb
+
+const (
+    SortedSetMembers = TupleLeft
+    SortedSetScores = TupleRight
+    // The children of the SortedSetScores Map.
+    SortedSetIndex = Key(0)
+    SortedSetPrefixCounts = Key(1)
+    SortedSetScoreCounts = Key(2)
+    headerSortedSet = byte(41)
+    // Scores are counted under each of their first 7 bytes and then in full.
+    sortedSetPrefixLevels = 7
+)
+
+var (
+    // Prefix counters are keyed by the prefix length in bytes followed by the prefix.
+    sortedSetCounterLayout = []uint{8, 56}
+)
+
+type ScoredMember struct {
+    Member Key
+    Score float64
+}
+
+// A SortedSet works like a Redis ZSET. It is a Tuple holding a Map of member -> score and a Map holding the index, a
+// Map of score -> Set of members so the composite (score, member) sorts by score and then member, along with counts of
+// the members under every byte prefix of their score. Scores are encoded with Float64ToKey.
+type SortedSet struct {
+    bund *Bundle
+    members *Map
+    index *Map
+    prefixCounts *Map
+    scoreCounts *Map
+}
+
+func sortedSetFromBundle(bund *Bundle) (*SortedSet, error) {
+    members, err := bund.FindMap(SortedSetMembers)
+    if err != nil {
+        return nil, err
+    }
+    index, err := bund.FindMap(SortedSetScores, SortedSetIndex)
+    if err != nil {
+        return nil, err
+    }
+    prefixCounts, err := bund.FindMap(SortedSetScores, SortedSetPrefixCounts)
+    if err != nil {
+        return nil, err
+    }
+    scoreCounts, err := bund.FindMap(SortedSetScores, SortedSetScoreCounts)
+    if err != nil {
+        return nil, err
+    }
+    return &SortedSet{bund, members, index, prefixCounts, scoreCounts}, nil
+}
+
+// Set the score of `member`, returning true if the member already existed.
+func (z *SortedSet) ZAdd(member Key, score float64) (bool, error) {
+    old, exists, err := z.ZScore(member)
+    if err != nil {
+        return false, err
+    }
+    if exists {
+        if old == score {
+            return true, nil
+        }
+        err = z.removeFromScore(member, old)
+        if err != nil {
+            return false, err
+        }
+    }
+    scoreKey := Float64ToKey(score)
+    _, err = z.members.Insert(member, scoreKey.Bytes())
+    if err != nil {
+        return false, err
+    }
+    bucket, err := z.index.bund.FindSet(scoreKey)
+    if err != nil {
+        return false, err
+    }
+    if _, err = bucket.Add(member); err != nil {
+        return false, err
+    }
+    return exists, z.count(scoreKey, 1)
+}
+
+func (z *SortedSet) ZScore(member Key) (float64, bool, error) {
+    val, exists, err := z.members.Lookup(member)
+    if err != nil || !exists {
+        return 0, false, err
+    }
+    return KeyToFloat64(BytesToKey(val)), true, nil
+}
+
+// Remove `member`, returning true if it existed.
+func (z *SortedSet) ZRem(member Key) (bool, error) {
+    score, exists, err := z.ZScore(member)
+    if err != nil || !exists {
+        return false, err
+    }
+    _, err = z.members.Delete(member)
+    if err != nil {
+        return false, err
+    }
+    return true, z.removeFromScore(member, score)
+}
+
+// Add `delta` to the score of `member`, treating a missing member as having a score of 0. Returns the new score.
+func (z *SortedSet) ZIncrBy(member Key, delta float64) (float64, error) {
+    score, _, err := z.ZScore(member)
+    if err != nil {
+        return 0, err
+    }
+    score += delta
+    _, err = z.ZAdd(member, score)
+    return score, err
+}
+
+// Members with scores between `min` and `max` inclusive, in score order. Members with equal scores are ordered by Key.
+// Returns at most `limit` members, or all of them if `limit` is negative.
+func (z *SortedSet) ZRangeByScore(min, max float64, limit int) ([]ScoredMember, error) {
+    ret := []ScoredMember{}
+    err := z.walk(Float64ToKey(min), func(scoreKey Key, member Key) bool {
+        if scoreKey > Float64ToKey(max) || (limit >= 0 && len(ret) >= limit) {
+            return false
+        }
+        ret = append(ret, ScoredMember{member, KeyToFloat64(scoreKey)})
+        return true
+    })
+    return ret, err
+}
+
+// The 0-based position of `member` when ordered by score. Each byte of the score is a Seek over the counters of at most
+// 255 lower prefixes, then the members tied on the same score before `member` are counted.
+func (z *SortedSet) ZRank(member Key) (int, bool, error) {
+    score, exists, err := z.ZScore(member)
+    if err != nil || !exists {
+        return 0, false, err
+    }
+    target := Float64ToKey(score)
+    rank := 0
+    for level := 1; level <= sortedSetPrefixLevels; level++ {
+        end := prefixCounter(level, target)
+        n, err := sumCounts(z.prefixCounts, end &^ 0xff, end)
+        if err != nil {
+            return 0, false, err
+        }
+        rank += n
+    }
+    n, err := sumCounts(z.scoreCounts, target &^ 0xff, target)
+    if err != nil {
+        return 0, false, err
+    }
+    rank += n
+    bucket, err := z.index.bund.FindSet(target)
+    if err != nil {
+        return 0, false, err
+    }
+    it, err := bucket.Iterator()
+    if err != nil {
+        return 0, false, err
+    }
+    for it.Seek(MinKey); it.IsValid() && it.Key() < member; it.Next() {
+        rank++
+    }
+    return rank, true, IterErr(it)
+}
+
+// Number of members, from the counters of the first byte of the scores.
+func (z *SortedSet) ZCard() (int, error) {
+    start := prefixCounter(1, MinKey)
+    return sumCounts(z.prefixCounts, start, start + 256)
+}
+
+func (z *SortedSet) removeFromScore(member Key, score float64) error {
+    scoreKey := Float64ToKey(score)
+    exists, err := z.index.bund.removeFromChildSet(scoreKey, member)
+    if err != nil || !exists {
+        return err
+    }
+    return z.count(scoreKey, -1)
+}
+
+// The key of the counter for the first `level` bytes of `scoreKey`.
+func prefixCounter(level int, scoreKey Key) Key {
+    k, _ := PackKey(sortedSetCounterLayout, uint64(level), uint64(scoreKey) >> uint(64 - 8 * level))
+    return k
+}
+
+// Add `delta` to the counters of every prefix of `scoreKey` and to its own.
+func (z *SortedSet) count(scoreKey Key, delta int) error {
+    for level := 1; level <= sortedSetPrefixLevels; level++ {
+        if err := addCount(z.prefixCounts, prefixCounter(level, scoreKey), delta); err != nil {
+            return err
+        }
+    }
+    return addCount(z.scoreCounts, scoreKey, delta)
+}
+
+func addCount(m *Map, key Key, delta int) error {
+    val, _, err := m.Lookup(key)
+    if err != nil {
+        return err
+    }
+    n := int64(BytesToKey(val)) + int64(delta)
+    if n <= 0 {
+        _, err = m.Delete(key)
+    } else {
+        _, err = m.Insert(key, Key(n).Bytes())
+    }
+    return err
+}
+
+// Sum the counters from `start` up to but not including `end`.
+func sumCounts(m *Map, start, end Key) (int, error) {
+    if start >= end {
+        return 0, nil
+    }
+    it, err := m.Iterator()
+    if err != nil {
+        return 0, err
+    }
+    total := 0
+    for it.Seek(start); it.IsValid() && it.Key() < end; it.Next() {
+        val, _, err := m.Lookup(it.Key())
+        if err != nil {
+            return 0, err
+        }
+        total += int(BytesToKey(val))
+    }
+    return total, IterErr(it)
+}
+
+// Call `f` for every (score, member) starting at `start` until it returns false.
+func (z *SortedSet) walk(start Key, f func(Key, Key) bool) error {
+    it, err := z.index.Iterator()
+    if err != nil {
+        return err
+    }
+    for it.Seek(start); it.IsValid(); it.Next() {
+        scoreKey := it.Key()
+        bucket, err := z.index.bund.FindSet(scoreKey)
+        if err != nil {
+            return err
+        }
+        mit, err := bucket.Iterator()
+        if err != nil {
+            return err
+        }
+        for mit.Seek(MinKey); mit.IsValid(); mit.Next() {
+            if !f(scoreKey, mit.Key()) {
+                return nil
+            }
+        }
+    }
+    return nil
+}
+
+type RootSortedSet struct {
+    *SortedSet
+    root *Root
+}
+func sortedSetFromRoot(root *Root) (*RootSortedSet, error) {
+    m, err := sortedSetFromBundle(root.Bundle)
+    return &RootSortedSet{m, root}, err
+}
+func (m *RootSortedSet) Commit() error {
+    return m.root.Commit()
+}
+func (m *RootSortedSet) Close() {
+    m.root.Close()
+}
@@ -0,0 +1,193 @@
+package bundledb
+
+import (
+    "math"
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestSortedSet(t *testing.T) {
+    num := MAX_SHARD_SET_SIZE * 4
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            zz, err := GetRootSortedSet(Key(0), txn)
+            require.NoError(t, err)
+            defer zz.Close()
+
+            // Scores descend as members ascend, every pair of members shares a score.
+            for x := 0; x < num; x++ {
+                exists, err := zz.ZAdd(Key(x), float64(num / 2 - x / 2))
+                require.NoError(t, err)
+                require.False(t, exists)
+            }
+            exists, err := zz.ZAdd(Key(0), -100.5)
+            require.NoError(t, err)
+            require.True(t, exists)
+            return zz.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            zz, err := GetRootSortedSet(Key(0), txn)
+            require.NoError(t, err)
+            defer zz.Close()
+
+            score, exists, err := zz.ZScore(Key(0))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, -100.5, score)
+
+            rank, exists, err := zz.ZRank(Key(0))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, 0, rank)
+
+            // Key(num - 2) and Key(num - 1) share the lowest positive score.
+            rank, _, err = zz.ZRank(Key(num - 1))
+            require.NoError(t, err)
+            require.Equal(t, 2, rank)
+            rank, _, err = zz.ZRank(Key(num - 2))
+            require.NoError(t, err)
+            require.Equal(t, 1, rank)
+
+            members, err := zz.ZRangeByScore(2, 3, -1)
+            require.NoError(t, err)
+            require.Equal(t, []ScoredMember{
+                {Key(num - 4), 2}, {Key(num - 3), 2}, {Key(num - 6), 3}, {Key(num - 5), 3},
+            }, members)
+
+            members, err = zz.ZRangeByScore(-1000, 1000, 2)
+            require.NoError(t, err)
+            require.Equal(t, []ScoredMember{{Key(0), -100.5}, {Key(num - 2), 1}}, members)
+
+            score, err = zz.ZIncrBy(Key(0), 200)
+            require.NoError(t, err)
+            require.Equal(t, 99.5, score)
+            score, err = zz.ZIncrBy(Key(num + 1), 5)
+            require.NoError(t, err)
+            require.Equal(t, 5.0, score)
+
+            for x := 1; x < num; x++ {
+                exists, err := zz.ZRem(Key(x))
+                require.NoError(t, err)
+                require.True(t, exists)
+            }
+            exists, err = zz.ZRem(Key(1))
+            require.NoError(t, err)
+            require.False(t, exists)
+            return zz.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            zz, err := GetRootSortedSet(Key(0), txn)
+            require.NoError(t, err)
+            defer zz.Close()
+
+            members, err := zz.ZRangeByScore(-1000, 1000, -1)
+            require.NoError(t, err)
+            require.Equal(t, []ScoredMember{{Key(num + 1), 5}, {Key(0), 99.5}}, members)
+            card, err := zz.ZCard()
+            require.NoError(t, err)
+            require.Equal(t, 2, card)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestNestedSortedSet(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            zz, err := root.FindSortedSet(Key(1), Key(2))
+            require.NoError(t, err)
+            for x := 0; x < MAX_EMBEDDED_SET_SIZE * 3; x++ {
+                zz.ZAdd(Key(x), 1)
+            }
+            return root.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            root, _ := GetRootBundle(Key(0), txn)
+            defer root.Close()
+
+            zz, err := root.FindSortedSet(Key(1), Key(2))
+            require.NoError(t, err)
+            members, err := zz.ZRangeByScore(1, 1, -1)
+            require.NoError(t, err)
+            require.Equal(t, MAX_EMBEDDED_SET_SIZE * 3, len(members))
+
+            _, err = root.FindSet(Key(1), Key(2))
+            requireTypeMismatch(t, err, TypeSet, TypeSortedSet)
+            // A SortedSet isn't mistaken for another collection built on a Tuple.
+            _, err = root.FindMultiMap(MultiMapOptions{}, Key(1), Key(2))
+            requireTypeMismatch(t, err, TypeMultiMap, TypeSortedSet)
+
+            child, err := root.ChildAny(Key(1))
+            require.NoError(t, err)
+            child, err = child.(*Map).bund.ChildAny(Key(2))
+            require.NoError(t, err)
+            _, ok := child.(*SortedSet)
+            require.True(t, ok)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestSortedSetRankCounts(t *testing.T) {
+    num := 500
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            zz, err := GetRootSortedSet(Key(0), txn)
+            require.NoError(t, err)
+            defer zz.Close()
+
+            // Scores spread over negatives, fractions and large magnitudes so the counters differ in every byte.
+            for x := 0; x < num; x++ {
+                score := float64((x * 7919) % num - num / 2) * 1.37
+                if x % 5 == 0 {
+                    score *= 1e12
+                }
+                _, err = zz.ZAdd(Key(x), score)
+                require.NoError(t, err)
+            }
+            for x := 0; x < num; x += 3 {
+                _, err = zz.ZRem(Key(x))
+                require.NoError(t, err)
+            }
+            return zz.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            zz, err := GetRootSortedSet(Key(0), txn)
+            require.NoError(t, err)
+            defer zz.Close()
+
+            all, err := zz.ZRangeByScore(math.Inf(-1), math.Inf(1), -1)
+            require.NoError(t, err)
+            card, err := zz.ZCard()
+            require.NoError(t, err)
+            require.Equal(t, len(all), card)
+            require.Equal(t, num - (num + 2) / 3, card)
+            for ii, sm := range all {
+                rank, exists, err := zz.ZRank(sm.Member)
+                require.NoError(t, err)
+                require.True(t, exists)
+                require.Equal(t, ii, rank)
+            }
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
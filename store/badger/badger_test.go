@@ -26,3 +26,7 @@ func TestItemCopy(t *testing.T) {
 func TestRunTestShardFind(t *testing.T) {
     RunBadgerTest(t, nil, store.RunTestShardFind)
 }
+
+func TestNextShardSeq(t *testing.T) {
+    RunBadgerTest(t, nil, store.RunTestNextShardSeq)
+}
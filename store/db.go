@@ -3,8 +3,12 @@ package store
 import (
     "time"
     "bytes"
+    "encoding/binary"
+    "sync/atomic"
 )
 
+var lastShardSeq uint64
+
 type DB struct {
     IDB
 }
@@ -64,13 +68,22 @@ func (rTxn *Txn) CanWrite() bool {
     return rTxn.write
 }
 
+// Shard ids are the current time in nanoseconds, bumped if needed so that two shards created
+// in the same process never share an id. Only the first 8 bytes are significant.
 func (rTxn *Txn) NextShardSeq() []byte {
-    r, err := time.Now().GobEncode()
-    if err != nil {
-        panic(err)
+    var seq uint64
+    for {
+        last := atomic.LoadUint64(&lastShardSeq)
+        seq = uint64(time.Now().UnixNano())
+        if seq <= last {
+            seq = last + 1
+        }
+        if atomic.CompareAndSwapUint64(&lastShardSeq, last, seq) {
+            break
+        }
     }
     x := make([]byte, 32)
-    copy(x, r)
+    binary.BigEndian.PutUint64(x, seq)
     return x
 }
 
@@ -1,6 +1,7 @@
 package store
 
 import (
+    "bytes"
     "fmt"
     "testing"
     "github.com/stretchr/testify/require"
@@ -127,3 +128,19 @@ func RunTestShardFind(t *testing.T, idb IDB) {
 }
 
 
+
+// Shard ids only use their first 8 bytes, so those have to differ even for ids taken in the same instant.
+func RunTestNextShardSeq(t *testing.T, idb IDB) {
+    db := NewDB(idb)
+
+    err := db.Update([]byte("test"), func(txn *Txn) error {
+        last := []byte{}
+        for ii := 0; ii < 10000; ii++ {
+            id := txn.NextShardSeq()[:8]
+            require.Equal(t, 1, bytes.Compare(id, last))
+            last = id
+        }
+        return nil
+    })
+    require.NoError(t, err)
+}
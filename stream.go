@@ -0,0 +1,280 @@
+package bundledb
+
+import (
+    "errors"
+)
+
+const (
+    StreamEntries = Key(0)
+    StreamGroups = Key(1)
+    StreamPending = Key(2)
+    StreamLastId = Key(3)
+    StreamLength = Key(4)
+    headerStreamPrim = byte(100)
+    headerStreamPointer = byte(101)
+    headerStreamDense = byte(102)
+)
+
+var (
+    InvalidStreamId = errors.New("Stream IDs must be greater than the last ID added")
+    NoSuchGroup = errors.New("Consumer group does not exist")
+)
+
+type StreamEntry struct {
+    Id Key
+    Value []byte
+}
+
+type PendingEntry struct {
+    Id Key
+    Consumer Key
+}
+
+// A Stream is an append only log like a Redis Stream. It is a Map holding a Map of id -> entry, the last delivered ID
+// of each consumer group, and a Map of id -> consumer per group for entries that were delivered but not acknowledged.
+// IDs increase like Timeline keys and start at 1, so a group created at 0 reads from the beginning.
+type Stream struct {
+    bund *Bundle
+    entries *Map
+    groups *Map
+}
+
+func streamFromBundle(bund *Bundle) (*Stream, error) {
+    entries, err := bund.FindMap(StreamEntries)
+    if err != nil {
+        return nil, err
+    }
+    groups, err := bund.FindMap(StreamGroups)
+    if err != nil {
+        return nil, err
+    }
+    return &Stream{bund, entries, groups}, nil
+}
+
+func (s *Stream) readCounter(key Key) (Key, error) {
+    val, exists, err := s.bund.Read(key)
+    if err != nil || !exists || val == nil {
+        return 0, err
+    }
+    return BytesToKey(val.Bytes()[1:]), nil
+}
+
+func (s *Stream) writeCounter(key Key, val Key) error {
+    _, err := s.bund.Write(key, UserVal(val.Bytes()))
+    return err
+}
+
+// Append `val` with the next ID, returning the ID.
+func (s *Stream) XAdd(val []byte) (Key, error) {
+    last, err := s.readCounter(StreamLastId)
+    if err != nil {
+        return 0, err
+    }
+    id := last.Next()
+    return id, s.XAddId(id, val)
+}
+
+// Append `val` with an explicit ID. Returns InvalidStreamId unless `id` is greater than every ID added so far.
+func (s *Stream) XAddId(id Key, val []byte) error {
+    last, err := s.readCounter(StreamLastId)
+    if err != nil {
+        return err
+    }
+    if id <= last {
+        return InvalidStreamId
+    }
+    length, err := s.readCounter(StreamLength)
+    if err != nil {
+        return err
+    }
+    if _, err = s.entries.Insert(id, val); err != nil {
+        return err
+    }
+    if err = s.writeCounter(StreamLastId, id); err != nil {
+        return err
+    }
+    return s.writeCounter(StreamLength, length + 1)
+}
+
+// Number of entries in the stream.
+func (s *Stream) XLen() (int, error) {
+    length, err := s.readCounter(StreamLength)
+    return int(length), err
+}
+
+// Entries with IDs between `start` and `end` inclusive. Returns at most `count` entries, or all of them if `count` is negative.
+func (s *Stream) XRange(start, end Key, count int) ([]StreamEntry, error) {
+    it, err := s.entries.Iterator()
+    if err != nil {
+        return nil, err
+    }
+    ids := []Key{}
+    for it.Seek(start); it.IsValid() && it.Key() <= end && (count < 0 || len(ids) < count); it.Next() {
+        ids = append(ids, it.Key())
+    }
+    ret := make([]StreamEntry, 0, len(ids))
+    for _, id := range ids {
+        val, _, err := s.entries.Lookup(id)
+        if err != nil {
+            return nil, err
+        }
+        ret = append(ret, StreamEntry{id, val})
+    }
+    return ret, nil
+}
+
+// Remove the oldest entries until at most `maxLen` remain, returning how many were removed.
+// Trimmed entries stay in the pending lists of consumer groups until they are acknowledged.
+func (s *Stream) XTrim(maxLen int) (int, error) {
+    length, err := s.XLen()
+    if err != nil || length <= maxLen {
+        return 0, err
+    }
+    it, err := s.entries.Iterator()
+    if err != nil {
+        return 0, err
+    }
+    ids := []Key{}
+    for it.Seek(MinKey); it.IsValid() && len(ids) < length - maxLen; it.Next() {
+        ids = append(ids, it.Key())
+    }
+    for _, id := range ids {
+        if _, err := s.entries.Delete(id); err != nil {
+            return 0, err
+        }
+    }
+    return len(ids), s.writeCounter(StreamLength, Key(length - len(ids)))
+}
+
+// Create a consumer group which will deliver entries after `start`. Returns true if the group already existed,
+// in which case it is left unchanged.
+func (s *Stream) XGroupCreate(group Key, start Key) (bool, error) {
+    _, exists, err := s.groups.Lookup(group)
+    if err != nil || exists {
+        return exists, err
+    }
+    _, err = s.groups.Insert(group, start.Bytes())
+    return false, err
+}
+
+// Remove a consumer group and its pending entries, returning true if it existed.
+func (s *Stream) XGroupDestroy(group Key) (bool, error) {
+    exists, err := s.groups.Delete(group)
+    if err != nil || !exists {
+        return exists, err
+    }
+    pending, err := s.bund.FindBundle(DecodeMap, StreamPending)
+    if err != nil {
+        return false, err
+    }
+    _, err = pending.DeleteChild(group)
+    return true, err
+}
+
+// The ID of the last entry delivered to `group`.
+func (s *Stream) LastDelivered(group Key) (Key, error) {
+    val, exists, err := s.groups.Lookup(group)
+    if err != nil {
+        return 0, err
+    }
+    if !exists {
+        return 0, NoSuchGroup
+    }
+    return BytesToKey(val), nil
+}
+
+func (s *Stream) pending(group Key) (*Map, error) {
+    return s.bund.FindMap(StreamPending, group)
+}
+
+// Deliver up to `count` entries that no consumer in `group` has seen yet to `consumer`. The entries stay pending
+// until they are acknowledged with XAck.
+func (s *Stream) XReadGroup(group Key, consumer Key, count int) ([]StreamEntry, error) {
+    last, err := s.LastDelivered(group)
+    if err != nil {
+        return nil, err
+    }
+    if last == MaxKey {
+        return []StreamEntry{}, nil
+    }
+    entries, err := s.XRange(last.Next(), MaxKey, count)
+    if err != nil || len(entries) == 0 {
+        return entries, err
+    }
+    pending, err := s.pending(group)
+    if err != nil {
+        return nil, err
+    }
+    for _, entry := range entries {
+        if _, err := pending.Insert(entry.Id, consumer.Bytes()); err != nil {
+            return nil, err
+        }
+    }
+    _, err = s.groups.Insert(group, entries[len(entries) - 1].Id.Bytes())
+    return entries, err
+}
+
+// Acknowledge `ids` for `group`, removing them from its pending list. Returns how many were pending.
+func (s *Stream) XAck(group Key, ids ...Key) (int, error) {
+    if _, err := s.LastDelivered(group); err != nil {
+        return 0, err
+    }
+    pending, err := s.pending(group)
+    if err != nil {
+        return 0, err
+    }
+    acked := 0
+    for _, id := range ids {
+        exists, err := pending.Delete(id)
+        if err != nil {
+            return 0, err
+        }
+        if exists {
+            acked++
+        }
+    }
+    return acked, nil
+}
+
+// Entries delivered to `group` that haven't been acknowledged, in ID order.
+func (s *Stream) XPending(group Key) ([]PendingEntry, error) {
+    if _, err := s.LastDelivered(group); err != nil {
+        return nil, err
+    }
+    pending, err := s.pending(group)
+    if err != nil {
+        return nil, err
+    }
+    it, err := pending.Iterator()
+    if err != nil {
+        return nil, err
+    }
+    ids := []Key{}
+    for it.Seek(MinKey); it.IsValid(); it.Next() {
+        ids = append(ids, it.Key())
+    }
+    ret := make([]PendingEntry, 0, len(ids))
+    for _, id := range ids {
+        consumer, _, err := pending.Lookup(id)
+        if err != nil {
+            return nil, err
+        }
+        ret = append(ret, PendingEntry{id, BytesToKey(consumer)})
+    }
+    return ret, nil
+}
+
+type RootStream struct {
+    *Stream
+    root *Root
+}
+func streamFromRoot(root *Root) (*RootStream, error) {
+    m, err := streamFromBundle(root.Bundle)
+    return &RootStream{m, root}, err
+}
+func (m *RootStream) Commit() error {
+    return m.root.Commit()
+}
+func (m *RootStream) Close() {
+    m.root.Close()
+}
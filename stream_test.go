@@ -0,0 +1,92 @@
+package bundledb
+
+import (
+    "testing"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 3
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            s, err := GetRootStream(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+
+            for x := 0; x < num; x++ {
+                id, err := s.XAdd(Key(x).Bytes())
+                require.NoError(t, err)
+                require.Equal(t, Key(x + 1), id)
+            }
+            require.Equal(t, InvalidStreamId, s.XAddId(Key(num), []byte("late")))
+
+            exists, err := s.XGroupCreate(Key(7), Key(0))
+            require.NoError(t, err)
+            require.False(t, exists)
+            exists, err = s.XGroupCreate(Key(7), Key(5))
+            require.NoError(t, err)
+            require.True(t, exists)
+            return s.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            s, err := GetRootStream(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+
+            length, err := s.XLen()
+            require.NoError(t, err)
+            require.Equal(t, num, length)
+
+            entries, err := s.XRange(Key(3), Key(5), -1)
+            require.NoError(t, err)
+            require.Equal(t, []StreamEntry{{Key(3), Key(2).Bytes()}, {Key(4), Key(3).Bytes()}, {Key(5), Key(4).Bytes()}}, entries)
+
+            entries, err = s.XReadGroup(Key(7), Key(100), 2)
+            require.NoError(t, err)
+            require.Equal(t, 2, len(entries))
+            entries, err = s.XReadGroup(Key(7), Key(101), 1)
+            require.NoError(t, err)
+            require.Equal(t, Key(3), entries[0].Id)
+
+            _, err = s.XReadGroup(Key(8), Key(100), 1)
+            require.Equal(t, NoSuchGroup, err)
+
+            acked, err := s.XAck(Key(7), Key(1), Key(3), Key(9))
+            require.NoError(t, err)
+            require.Equal(t, 2, acked)
+
+            removed, err := s.XTrim(num - 10)
+            require.NoError(t, err)
+            require.Equal(t, 10, removed)
+            return s.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            s, err := GetRootStream(Key(0), txn)
+            require.NoError(t, err)
+            defer s.Close()
+
+            length, err := s.XLen()
+            require.NoError(t, err)
+            require.Equal(t, num - 10, length)
+            entries, err := s.XRange(MinKey, MaxKey, 1)
+            require.NoError(t, err)
+            require.Equal(t, Key(11), entries[0].Id)
+
+            pending, err := s.XPending(Key(7))
+            require.NoError(t, err)
+            require.Equal(t, []PendingEntry{{Key(2), Key(100)}}, pending)
+            last, err := s.LastDelivered(Key(7))
+            require.NoError(t, err)
+            require.Equal(t, Key(3), last)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
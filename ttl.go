@@ -0,0 +1,163 @@
+package bundledb
+
+import (
+    "time"
+    "github.com/hansonkd/bundledb/store"
+)
+
+func expiryKey(t time.Time) Key {
+    if ns := t.UnixNano(); ns > 0 {
+        return Key(ns)
+    }
+    return MinKey
+}
+
+// Strip the header from a user value. Returns false if the value has expired.
+func userBytes(b []byte) ([]byte, bool) {
+    if len(b) > 0 && b[0] == headerUserExpiring {
+        if len(b) < 1 + KeyLength || BytesToKey(b[1:1 + KeyLength]) <= expiryKey(time.Now()) {
+            return nil, false
+        }
+        return b[1 + KeyLength:], true
+    }
+    return b[1:], true
+}
+
+// Rows of the expiry index are the expiry time followed by the path of the entry, so they sort by when they expire.
+func expireIndexKey(expires Key, path []Key) []byte {
+    b := append([]byte{tableExpire}, expires.Bytes()...)
+    for _, k := range path {
+        b = append(b, k.Bytes()...)
+    }
+    return b
+}
+
+// Insert `val` under `key` so that it is treated as missing once `ttl` has passed. The entry is only removed from
+// the database by ExpireSweep. Inserting again without a TTL makes the entry permanent.
+func (m *Map) InsertWithTTL(key Key, val []byte, ttl time.Duration) (bool, error) {
+    expires := expiryKey(time.Now().Add(ttl))
+    if err := m.dropBlob(key); err != nil {
+        return false, err
+    }
+    exists, err := m.bund.Write(key, expiringVal{expires, val})
+    if err != nil {
+        return false, err
+    }
+    return exists, m.bund.txn.Set(expireIndexKey(expires, m.path(key)), []byte{})
+}
+
+// Time left before the entry under `key` expires. Returns false if the entry is missing, expired or has no TTL.
+func (m *Map) TTL(key Key) (time.Duration, bool, error) {
+    val, exists, err := m.bund.Read(key)
+    if err != nil || !exists || val == nil {
+        return 0, false, err
+    }
+    b := val.Bytes()
+    if len(b) < 1 + KeyLength || b[0] != headerUserExpiring {
+        return 0, false, nil
+    }
+    left := time.Duration(BytesToKey(b[1:1 + KeyLength])) - time.Duration(time.Now().UnixNano())
+    if left <= 0 {
+        return 0, false, nil
+    }
+    return left, true, nil
+}
+
+// Delete up to `limit` Map entries whose TTL has passed, returning how many index rows were processed. Call it
+// repeatedly until it returns less than `limit` to clear the backlog.
+//
+// Pass the roots the transaction already has open as `open`. Expired entries under them are deleted through them
+// and left for the caller to commit. Any other root holding expired entries is opened and committed by the sweep.
+//
+// The expiry index is a table of its own rather than a Set, since its rows hold the whole path of an entry.
+func ExpireSweep(txn *store.Txn, limit int, open ...*Root) (int, error) {
+    now := expiryKey(time.Now())
+    it := txn.NewIterator(&store.IteratorOptions{Prefix: []byte{tableExpire}, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), Offset: 0, RangeType: store.RangeClose, Count: -1})
+    rows := [][]byte{}
+    for it.Start(); it.Valid() && len(rows) < limit; it.Next() {
+        row := txn.TrimDomain(it.Item().KeyCopy(nil))
+        if len(row) < 1 + 2 * KeyLength || BytesToKey(row[1:1 + KeyLength]) > now {
+            break
+        }
+        rows = append(rows, row)
+    }
+    it.Close()
+
+    roots := map[Key]*Root{}
+    for _, r := range open {
+        roots[r.key] = r
+    }
+    // The roots opened here, which the sweep commits and closes.
+    opened := map[Key]*Root{}
+    defer func() {
+        for _, r := range opened {
+            r.Close()
+        }
+    }()
+    for _, row := range rows {
+        expires := BytesToKey(row[1:1 + KeyLength])
+        path := []Key{}
+        for ii := 1 + KeyLength; ii + KeyLength <= len(row); ii += KeyLength {
+            path = append(path, BytesToKey(row[ii:ii + KeyLength]))
+        }
+        if err := expireEntry(txn, roots, opened, expires, path); err != nil {
+            return 0, err
+        }
+        if err := txn.Delete(row); err != nil {
+            return 0, err
+        }
+    }
+    for _, r := range opened {
+        if err := r.Commit(); err != nil {
+            return 0, err
+        }
+    }
+    return len(rows), nil
+}
+
+// Delete the entry at `path` if it still expires at `expires`. Entries that were rewritten or removed since the
+// index row was written are left alone. A root that isn't in `roots` is opened and added to both maps.
+func expireEntry(txn *store.Txn, roots, opened map[Key]*Root, expires Key, path []Key) error {
+    r, ok := roots[path[0]]
+    if !ok {
+        var err error
+        r, _, err = OpenAny(path[0], txn)
+        if err == NoCollection {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        roots[path[0]] = r
+        opened[path[0]] = r
+    }
+    bndl := r.Bundle
+    for _, key := range path[1:len(path) - 1] {
+        prim, err := bndl.Primitive(key)
+        if err != nil {
+            return err
+        }
+        state, ok := prim.Read(key)
+        if !ok || state == nil {
+            return nil
+        }
+        reg := registrationFor(state.Bytes())
+        if reg == nil || reg.Decoder == nil {
+            return nil
+        }
+        bndl, err = bndl.child(key, reg.Decoder, state)
+        if err != nil {
+            return err
+        }
+    }
+    key := path[len(path) - 1]
+    val, exists, err := bndl.Read(key)
+    if err != nil || !exists || val == nil {
+        return err
+    }
+    b := val.Bytes()
+    if len(b) >= 1 + KeyLength && b[0] == headerUserExpiring && BytesToKey(b[1:1 + KeyLength]) == expires {
+        _, err = bndl.Delete(key)
+    }
+    return err
+}
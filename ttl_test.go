@@ -0,0 +1,134 @@
+package bundledb
+
+import (
+    "testing"
+    "time"
+    "github.com/hansonkd/bundledb/store"
+    "github.com/hansonkd/bundledb/store/badger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestMapTTL(t *testing.T) {
+    num := MAX_SHARD_MAP_SIZE * 3
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+
+            nested, err := m.bund.FindMap(Key(1), Key(2))
+            require.NoError(t, err)
+            for x := 0; x < num; x++ {
+                ttl := time.Hour
+                if x % 2 == 0 {
+                    ttl = -time.Second
+                }
+                _, err := nested.InsertWithTTL(Key(x), Key(x).Bytes(), ttl)
+                require.NoError(t, err)
+            }
+            // Rewriting without a TTL keeps the entry.
+            _, err = nested.Insert(Key(0), []byte("kept"))
+            require.NoError(t, err)
+
+            _, exists, err := nested.Lookup(Key(2))
+            require.NoError(t, err)
+            require.False(t, exists)
+            val, exists, err := nested.Lookup(Key(1))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, Key(1).Bytes(), val)
+
+            ttl, exists, err := nested.TTL(Key(1))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.True(t, ttl > time.Minute)
+            _, exists, err = nested.TTL(Key(0))
+            require.NoError(t, err)
+            require.False(t, exists)
+            return m.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            swept, err := ExpireSweep(txn, 10)
+            require.NoError(t, err)
+            require.Equal(t, 10, swept)
+            swept, err = ExpireSweep(txn, 10)
+            require.NoError(t, err)
+            require.Equal(t, 5, swept)
+            swept, err = ExpireSweep(txn, 10)
+            require.NoError(t, err)
+            require.Equal(t, 0, swept)
+            return nil
+        })
+        require.NoError(t, err)
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+
+            nested, err := m.bund.FindMap(Key(1), Key(2))
+            require.NoError(t, err)
+            it, err := nested.Iterator()
+            require.NoError(t, err)
+            it.Seek(MinKey)
+            keys := collectKeys(it)
+            require.Equal(t, num / 2 + 1, len(keys))
+            require.Equal(t, Key(0), keys[0])
+            require.Equal(t, Key(1), keys[1])
+
+            val, exists, err := nested.Lookup(Key(0))
+            require.NoError(t, err)
+            require.True(t, exists)
+            require.Equal(t, []byte("kept"), val)
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
+
+func TestExpireSweepOpenRoots(t *testing.T) {
+    badger.RunBadgerTest(t, nil, func(t *testing.T, idb store.IDB) {
+        db := store.NewDB(idb)
+        err := db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            for x := 0; x < 5; x++ {
+                _, err := m.InsertWithTTL(Key(x), Key(x).Bytes(), -time.Second)
+                require.NoError(t, err)
+            }
+            return m.Commit()
+        })
+        require.NoError(t, err)
+
+        err = db.Update([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            _, err = m.Insert(Key(10), []byte("new"))
+            require.NoError(t, err)
+
+            // The sweep goes through the open root, so committing it doesn't bring the entries back.
+            swept, err := ExpireSweep(txn, 10, m.Root())
+            require.NoError(t, err)
+            require.Equal(t, 5, swept)
+            return m.Commit()
+        })
+        require.NoError(t, err)
+        require.Equal(t, 0, tableRows(t, db, tableExpire))
+
+        err = db.View([]byte("test"), func(txn *store.Txn) error {
+            m, err := GetRootMap(Key(0), txn)
+            require.NoError(t, err)
+            defer m.Close()
+            it, err := m.Iterator()
+            require.NoError(t, err)
+            require.Equal(t, []Key{Key(10)}, collectKeys(it))
+            return nil
+        })
+        require.NoError(t, err)
+    })
+}
@@ -3,9 +3,13 @@ package bundledb
 import (
     "bytes"
     "fmt"
+    "sort"
     "github.com/hansonkd/bundledb/store"
 )
 
+const (
+    MAX_COUNTED_SHARDS = 64
+)
 
 type iBundle interface {
     Primitive(Key) (Primitive, error)
@@ -28,7 +32,12 @@ type primIterator struct {
 func (pit *primIterator) Next() { pit.ii++ }
 func (pit *primIterator) IsValid() bool { return pit.ii < len(pit.keys) }
 func (pit *primIterator) Key() Key { return pit.keys[pit.ii] }
+func (pit *primIterator) EstimatedSize() int { return len(pit.keys) }
 func (pit *primIterator) Seek(item Key) {
+    if pit.IsValid() && item >= pit.keys[pit.ii] {
+        pit.ii = gallopKeys(pit.keys, pit.ii, item)
+        return
+    }
     starting := searchBytes(pit.keys, item)
     if starting < 0 {
         starting = -starting - 1
@@ -39,6 +48,8 @@ func (pit *primIterator) Seek(item Key) {
 type primBundle struct {
     prim Primitive
     primType Decoder
+    // Nothing was stored yet. The empty primitive is still committed so its header records the collection's type.
+    created bool
 }
 
 func newPrimitiveBundle(primType Decoder, primBytes []byte, write bool) (*primBundle, error) {
@@ -55,6 +66,7 @@ func newPrimitiveBundle(primType Decoder, primBytes []byte, write bool) (*primBu
     bundle := &primBundle{
         prim: prim,
         primType: primType,
+        created: write && primBytes == nil,
     }
     return bundle, nil
 }
@@ -66,7 +78,8 @@ func (bund *primBundle) Iterator() (BundleIterator, error) {
     return &primIterator{keys, 0}, nil
 }
 func (bund *primBundle) Commit(txn *store.Txn) (Value, error) {
-    if bund.prim.IsDirty() {
+    if bund.prim.IsDirty() || bund.created {
+        bund.created = false
         if bund.prim.CanPopEmbed() {
             shardId := txn.NextShardSeq()[:8]
             err := commitShard(txn, bund.prim, append([]byte{bund.primType.Table()}, shardId...), MaxKey)
@@ -83,11 +96,23 @@ func (bund *primBundle) Close() {}
 type shardIterator struct {
     keys []Key
     ii int
+    shard Key
     bund *shardBundle
+    // The estimate, once taken. Sorting by size asks for it many times.
+    size int
+    // The error from loading a shard. The iterator stays invalid once it's set.
+    err error
 }
 
 func (pit *shardIterator) Seek(item Key) {
+    if pit.err != nil {
+        return
+    }
     if len(pit.keys) > 0 {
+        if pit.IsValid() && item >= pit.keys[pit.ii] && item <= pit.keys[len(pit.keys) - 1] {
+            pit.ii = gallopKeys(pit.keys, pit.ii, item)
+            return
+        }
         if item >= pit.keys[0] && item <= pit.keys[len(pit.keys) - 1] {
             starting := searchBytes(pit.keys, item)
             if starting < 0 {
@@ -97,17 +122,25 @@ func (pit *shardIterator) Seek(item Key) {
             return
         }
     }
-    prim, err := pit.bund.Primitive(item)
+    // Remember which shard we are on so Next can find the one after it.
+    shard, prim, err := pit.bund.lookupShard(item)
     if err != nil {
-        panic(err)
+        pit.fail(err)
+        return
     }
-    keys := prim.Keys()
-    starting := searchBytes(keys, item)
-    if starting < 0 {
-        starting = -starting - 1
+    pit.shard = MaxKey
+    pit.keys = []Key{}
+    pit.ii = 0
+    if prim != nil {
+        pit.shard = shard
+        pit.keys = prim.Keys()
+        starting := searchBytes(pit.keys, item)
+        if starting < 0 {
+            starting = -starting - 1
+        }
+        pit.ii = starting
     }
-    pit.keys = keys
-    pit.ii = starting
+    pit.skipEmpty()
 }
 func (pit *shardIterator) Next() {
     if pit.keys == nil {
@@ -115,22 +148,47 @@ func (pit *shardIterator) Next() {
         return
     }
     pit.ii++
-    if !pit.IsValid() {
-        bund := pit.bund
-        bund.it.Next()
-        if bund.it.Valid() {
-            key := bund.currentKey()
-            bund.itr_cache[key] = key
-            prim, err := bund.loadFromIterator(key)
-            if err != nil {
-                panic(err)
-            }
-            pit.ii = 0
-            pit.keys = prim.Keys()
+    pit.skipEmpty()
+}
+// Move on to the next shard with keys once this one runs out.
+func (pit *shardIterator) skipEmpty() {
+    for !pit.IsValid() && pit.shard != MaxKey {
+        key, prim, err := pit.bund.lookupShard(pit.shard + 1)
+        if err != nil {
+            pit.fail(err)
+            return
         }
+        if prim == nil {
+            return
+        }
+        pit.shard = key
+        pit.ii = 0
+        pit.keys = prim.Keys()
     }
 }
-func (pit *shardIterator) IsValid() bool { return pit.ii < len(pit.keys) }
+// Stop at `err`, leaving the iterator without keys.
+func (pit *shardIterator) fail(err error) {
+    pit.err = err
+    pit.shard = MaxKey
+    pit.keys = []Key{}
+    pit.ii = 0
+}
+func (pit *shardIterator) Err() error { return pit.err }
+// A new iterator starts at the first key, like a primIterator.
+func (pit *shardIterator) IsValid() bool {
+    if pit.keys == nil {
+        pit.Seek(MinKey)
+    }
+    return pit.ii < len(pit.keys)
+}
+// The number of shards times how full a shard is on average. Only shard keys are read, not their values, and
+// counting stops at MAX_COUNTED_SHARDS since past that the order between two iterators matters little.
+func (pit *shardIterator) EstimatedSize() int {
+    if pit.size < 0 {
+        pit.size = pit.bund.shardCount() * shardFill(pit.bund.primType)
+    }
+    return pit.size
+}
 func (pit *shardIterator) Key() Key { return pit.keys[pit.ii] }
 
 
@@ -139,10 +197,15 @@ type shardBundle struct {
     it *store.Iterator
     shardRangeId []byte
     prim Primitive
+    primKey Key
     primBytes []byte
     primType Decoder
     itr_cache map[Key]Key
     cache map[Key]Primitive
+    // The keys of `cache` in order. Shards split during the transaction are only here until Commit.
+    cacheKeys []Key
+    // Set when an embedded bundle popped out before Commit, so Commit returns the new pointer.
+    popped bool
 }
 
 func newShardBundle(txn *store.Txn, primType Decoder, primBytes []byte) (*shardBundle, error) {
@@ -162,16 +225,47 @@ func newShardBundle(txn *store.Txn, primType Decoder, primBytes []byte) (*shardB
     }
     return bundle, nil
 }
+// Shards are split in half once they pass the maximum size, so on average they are three quarters full.
+func shardFill(primType Decoder) int {
+    max := 1
+    switch primType.Type() {
+    case TypeSet:
+        max = MAX_SHARD_SET_SIZE
+    case TypeMap, TypeBitmap, TypeStream:
+        max = MAX_SHARD_MAP_SIZE
+    }
+    if fill := max * 3 / 4; fill > 0 {
+        return fill
+    }
+    return 1
+}
+
+// Count the stored shards along with those only split off during this transaction, up to MAX_COUNTED_SHARDS.
+func (bund *shardBundle) shardCount() int {
+    // Lookups always seek the store iterator first, so it can be borrowed here.
+    stored := map[Key]bool{}
+    for bund.it.Start(); bund.it.Valid() && len(stored) < MAX_COUNTED_SHARDS; bund.it.Next() {
+        stored[bund.currentKey()] = true
+    }
+    n := len(stored)
+    for _, key := range bund.cacheKeys {
+        if !stored[key] && n < MAX_COUNTED_SHARDS {
+            n++
+        }
+    }
+    return n
+}
 func (bund *shardBundle) Iterator() (BundleIterator, error) {
-    return &shardIterator{nil, 0, bund}, nil
+    return &shardIterator{nil, 0, MaxKey, bund, -1, nil}, nil
 }
 func (bund *shardBundle) Primitive(item Key) (Primitive, error) {
     if bund.prim == nil || !bund.prim.InRange(item) {
-        nprim, err := bund.lookupShard(item)
+        key, nprim, err := bund.lookupShard(item)
         if err != nil {
             return nil, err
         }
         bund.prim = nprim
+        bund.primKey = key
     }
     return bund.prim, nil
 }
@@ -187,6 +281,10 @@ func (bund *shardBundle) Commit(txn *store.Txn) (Value, error) {
             }
         }
     }
+    if bund.popped {
+        bund.popped = false
+        return RawVal(bund.primBytes), nil
+    }
     return nil, nil
 
 }
@@ -195,16 +293,21 @@ func (bund *shardBundle) Close() {
     bund.it.Close()
     bund.itr_cache = nil
     bund.cache = nil
+    bund.cacheKeys = nil
 }
 
-func (bund *shardBundle) lookupShard(searchKey Key) (Primitive, error) {
-    if shardKey, ok := bund.itr_cache[searchKey]; ok {
-        return bund.cache[shardKey], nil
+// Find the shard holding `searchKey` and its key. Shards split during the transaction aren't in the store yet, so
+// the first cached shard at or after `searchKey` wins over the store when it comes first.
+func (bund *shardBundle) lookupShard(searchKey Key) (Key, Primitive, error) {
+    cached, hasCached := bund.cachedShardFrom(searchKey)
+    if hasCached && bund.cache[cached].InRange(searchKey) {
+        return cached, bund.cache[cached], nil
     }
-    for _, prim := range bund.cache {
-        if prim.InRange(searchKey) {
-            return prim, nil
+    if shardKey, ok := bund.itr_cache[searchKey]; ok {
+        if hasCached && cached < shardKey {
+            shardKey = cached
         }
+        return shardKey, bund.cache[shardKey], nil
     }
     bund.it.Seek(searchKey.Bytes())
     if bund.it.Valid() {
@@ -212,14 +315,153 @@ func (bund *shardBundle) lookupShard(searchKey Key) (Primitive, error) {
         if searchKey > key {
             panic(fmt.Sprintf("%d > %d", searchKey, key))
         }
+        if hasCached && cached < key {
+            return cached, bund.cache[cached], nil
+        }
         bund.itr_cache[searchKey] = key
         bund.itr_cache[key] = key
-        return bund.loadFromIterator(key)
+        prim, err := bund.loadFromIterator(key)
+        return key, prim, err
+    } else if hasCached {
+        return cached, bund.cache[cached], nil
     } else {
         println("Invalid")
-        return nil, nil
+        return 0, nil, nil
+    }
+}
+
+// The first cached shard key at or after `key`.
+func (bund *shardBundle) cachedShardFrom(key Key) (Key, bool) {
+    ix := sort.Search(len(bund.cacheKeys), func(i int) bool { return bund.cacheKeys[i] >= key })
+    if ix == len(bund.cacheKeys) {
+        return 0, false
+    }
+    return bund.cacheKeys[ix], true
+}
+
+func (bund *shardBundle) cacheShard(key Key, prim Primitive) {
+    if _, ok := bund.cache[key]; !ok {
+        ix := sort.Search(len(bund.cacheKeys), func(i int) bool { return bund.cacheKeys[i] >= key })
+        bund.cacheKeys = append(bund.cacheKeys, 0)
+        copy(bund.cacheKeys[ix + 1:], bund.cacheKeys[ix:])
+        bund.cacheKeys[ix] = key
     }
+    bund.cache[key] = prim
 }
+
+// Whether `prim` is big enough to split before Commit. Only Maps and Sets split early.
+func splitEarly(prim Primitive) bool {
+    switch p := prim.(type) {
+    case *primMap:
+        return len(p.keys) >= MAX_SHARD_MAP_SIZE * 2
+    case *primSet:
+        return len(p.keys) >= MAX_SHARD_SET_SIZE * 2
+    }
+    return false
+}
+
+// Split `prim` so a large transaction never works on one huge primitive. The lower half becomes a new shard under
+// its largest key and `prim` keeps the upper half under its own key.
+func (bund *shardBundle) splitFull(prim Primitive) {
+    if !splitEarly(prim) || prim != bund.prim {
+        return
+    }
+    if lower := prim.Split(); lower != nil {
+        bund.cacheShard(lower.Max(), lower)
+    }
+}
+
+// The largest key at or before `key` in the shards that end before `key`. Shards are walked newest to oldest with
+// a reverse iterator, along with shards split during the transaction that only exist in the cache.
+func (bund *shardBundle) floorBefore(key Key) (Key, bool, error) {
+    prefix := append([]byte{bund.primType.Table()}, bund.shardRangeId...)
+    it := bund.txn.NewIterator(&store.IteratorOptions{Prefix: prefix, StartKey: MaxKey.Bytes(), Offset: 0, Count: -1})
+    defer it.Close()
+    for bound := key; bound > MinKey; {
+        shardKey, found := Key(0), false
+        it.Seek((bound - 1).Bytes())
+        if it.Valid() {
+            shardKey, found = BytesToKey(it.TrimPrefix(bund.txn.TrimDomain(it.Item().Key()))), true
+        }
+        ix := sort.Search(len(bund.cacheKeys), func(i int) bool { return bund.cacheKeys[i] >= bound })
+        if ix > 0 && (!found || bund.cacheKeys[ix - 1] > shardKey) {
+            shardKey, found = bund.cacheKeys[ix - 1], true
+        }
+        if !found {
+            break
+        }
+        prim, ok := bund.cache[shardKey]
+        if !ok {
+            rawVal, err := it.Item().Value()
+            if err != nil {
+                return 0, false, err
+            }
+            prim = bund.primType.NewPrimitive()
+            if err := prim.FromBytesReadOnly(rawVal); err != nil {
+                return 0, false, err
+            }
+        }
+        if found, ok := floorKey(prim.Keys(), key); ok {
+            return found, true, nil
+        }
+        bound = shardKey
+    }
+    return 0, false, nil
+}
+
+// Delete the shards whose keys all fall between `start` and `end` inclusive without reading them. A shard holds the
+// keys after the previous shard's key up to its own key. The last shard is always kept.
+func (bund *shardBundle) dropShardsIn(start, end Key) error {
+    prefix := append([]byte{bund.primType.Table()}, bund.shardRangeId...)
+    it := bund.txn.NewIterator(&store.IteratorOptions{Prefix: prefix, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), Offset: 0, RangeType: store.RangeClose, Count: -1})
+    shardKeys := []Key{}
+    // The first shard from `start` is only covered if the shard before it ends at `start` - 1.
+    covered, from := true, start
+    if start > MinKey {
+        covered, from = false, start - 1
+    }
+    for it.Seek(from.Bytes()); it.Valid(); it.Next() {
+        shardKey := BytesToKey(it.TrimPrefix(bund.txn.TrimDomain(it.Item().Key())))
+        if shardKey < start {
+            covered = true
+            continue
+        }
+        if shardKey > end || shardKey == MaxKey {
+            break
+        }
+        if covered {
+            shardKeys = append(shardKeys, shardKey)
+        }
+        covered = true
+    }
+    it.Close()
+    for _, shardKey := range shardKeys {
+        if err := bund.txn.Delete(append(append([]byte{}, prefix...), shardKey.Bytes()...)); err != nil {
+            return err
+        }
+        if bund.prim != nil && bund.prim == bund.cache[shardKey] {
+            bund.prim = nil
+        }
+        delete(bund.cache, shardKey)
+    }
+    for searchKey, shardKey := range bund.itr_cache {
+        if _, ok := bund.cache[shardKey]; !ok {
+            delete(bund.itr_cache, searchKey)
+        }
+    }
+    cacheKeys := bund.cacheKeys[:0]
+    for _, shardKey := range bund.cacheKeys {
+        if _, ok := bund.cache[shardKey]; ok {
+            cacheKeys = append(cacheKeys, shardKey)
+        }
+    }
+    bund.cacheKeys = cacheKeys
+    // Store iterators may not see deletes made after they were opened.
+    bund.it.Close()
+    bund.it = bund.txn.NewIterator(&store.IteratorOptions{Prefix: prefix, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), Offset: 0, RangeType: store.RangeClose, Count: -1})
+    return nil
+}
+
 func (bund *shardBundle) currentKey() Key {
     item := bund.it.Item()
     fullKey := bund.txn.TrimDomain(item.Key())
@@ -241,7 +483,7 @@ func (bund *shardBundle) loadFromIterator(key Key) (Primitive, error) {
         } else {
             err = prim.FromBytesReadOnly(rawVal)
         }
-        bund.cache[key] = prim
+        bund.cacheShard(key, prim)
         return prim, err
     }
     if err != nil {
@@ -273,3 +515,19 @@ func commitShard(txn *store.Txn, prim Primitive, prefix []byte, key Key) error {
         return txn.Set(shardKey, b.Bytes())
     }
 }
+
+// Delete every shard stored under `prefix`.
+func dropShards(txn *store.Txn, prefix []byte) error {
+    it := txn.NewIterator(&store.IteratorOptions{Prefix: prefix, StartKey: MinKey.Bytes(), EndKey: MaxKey.Bytes(), Offset: 0, RangeType: store.RangeClose, Count: -1})
+    shardKeys := [][]byte{}
+    for it.Start(); it.Valid(); it.Next() {
+        shardKeys = append(shardKeys, txn.TrimDomain(it.Item().KeyCopy(nil)))
+    }
+    it.Close()
+    for _, k := range shardKeys {
+        if err := txn.Delete(k); err != nil {
+            return err
+        }
+    }
+    return nil
+}